@@ -0,0 +1,232 @@
+package ez
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Tx collects the writes of a SafeMap Batch
+type Tx = TxOf[string, interface{}]
+
+// TxOf collects inserts and deletes that Batch applies together.
+// It is only valid inside the Batch callback.
+type TxOf[K comparable, V any] struct {
+	m       *SafeMapOf[K, V]
+	ops     []txOp[K, V]
+	pending map[K]int
+}
+
+type txOp[K comparable, V any] struct {
+	key K
+	e   *entry[V] // nil means delete
+}
+
+// Insert queues a store of value under key with an access counter and no TTL.
+// example usage: tx.Insert("user:42", 0, profile)
+func (tx *TxOf[K, V]) Insert(key K, counter uint32, value V, tags ...string) {
+	tx.InsertWithTTL(key, 0, counter, value, tags...)
+}
+
+// InsertWithTTL queues a store of value under key with a TTL and access counter.
+// example usage: tx.InsertWithTTL("session:abc", time.Hour, 0, session)
+func (tx *TxOf[K, V]) InsertWithTTL(key K, ttl time.Duration, counter uint32, value V, tags ...string) {
+	key = copyKey(key)
+	e := tx.m.newEntry(copyValue(value), ttl, counter)
+	e.tags = copyTags(tags)
+	tx.queue(key, e)
+}
+
+// Delete queues the removal of key.
+// example usage: tx.Delete("email:old@example.com")
+func (tx *TxOf[K, V]) Delete(key K) {
+	tx.queue(key, nil)
+}
+
+// Get returns the value the key will have after the batch, so queued writes are visible.
+// Keys the batch did not touch are read like Peek, their access counter is not used up.
+// example usage: profile, ok := tx.Get("user:42")
+func (tx *TxOf[K, V]) Get(key K) (V, bool) {
+	if i, ok := tx.pending[key]; ok {
+		if e := tx.ops[i].e; e != nil {
+			return e.value, true
+		}
+		var zero V
+		return zero, false
+	}
+	return tx.m.Peek(key)
+}
+
+func (tx *TxOf[K, V]) queue(key K, e *entry[V]) {
+	if tx.pending == nil {
+		tx.pending = make(map[K]int)
+	}
+	if i, ok := tx.pending[key]; ok {
+		tx.ops[i].e = e
+		return
+	}
+	tx.pending[key] = len(tx.ops)
+	tx.ops = append(tx.ops, txOp[K, V]{key: key, e: e})
+}
+
+// Batch runs fn and then applies all of its writes at once. Every shard the batch
+// touches is locked for the whole apply, so readers see either none or all of it.
+// Nothing is written when fn returns an error or when the map cannot take one of the
+// writes: a value over the byte budget or one the write-ahead log cannot encode.
+// A bounded map still evicts other keys to make room, TinyLFU admits every key of a batch.
+// example usage:
+//
+//	err := m.Batch(func(tx *ez.Tx) error {
+//		tx.InsertWithTTL("user:42", 0, 0, profile)
+//		tx.Delete("email:" + oldEmail)
+//		tx.InsertWithTTL("email:"+profile.Email, 0, 0, "42")
+//		return nil
+//	})
+func (m *SafeMapOf[K, V]) Batch(fn func(tx *TxOf[K, V]) error) error {
+	tx := &TxOf[K, V]{m: m}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return m.apply(tx.ops)
+}
+
+// MSet stores every value of values with the same TTL in one atomic step.
+// Like Batch it stores nothing and returns an error when one of the values cannot be stored.
+// example usage: err := m.MSet(map[string]interface{}{"a": 1, "b": 2}, time.Minute)
+func (m *SafeMapOf[K, V]) MSet(values map[K]V, ttl time.Duration) error {
+	ops := make([]txOp[K, V], 0, len(values))
+	for key, value := range values {
+		ops = append(ops, txOp[K, V]{key: copyKey(key), e: m.newEntry(copyValue(value), ttl, 0)})
+	}
+	return m.apply(ops)
+}
+
+// MGet looks up several keys like Get, locking each shard only once.
+// Missing keys are left out of the result. A key listed twice is read once,
+// so it uses up one access and counts as one hit or miss.
+// example usage: found := m.MGet("user:1", "user:2", "user:3")
+func (m *SafeMapOf[K, V]) MGet(keys ...K) map[K]V {
+	found := make(map[K]V, len(keys))
+	seen := make(map[K]struct{}, len(keys))
+	byShard := make(map[int][]K)
+	for _, key := range keys {
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+		i := m.getShardIndex(key)
+		byShard[i] = append(byShard[i], key)
+	}
+
+	var evs []eviction[K, V]
+	shards := shardOrder(byShard)
+	m.lockShards(shards)
+	now := m.now()
+	for _, i := range shards {
+		s := m.shards[i]
+		for _, key := range byShard[i] {
+			value, ok, kevs := m.getLocked(s, key, now)
+			if ok {
+				found[key] = value
+			}
+			m.publishAll(kevs)
+			evs = append(evs, kevs...)
+		}
+	}
+	m.unlockShards(shards)
+
+	m.stats.hits.Add(uint64(len(found)))
+	m.stats.misses.Add(uint64(len(seen) - len(found)))
+	m.notifyAll(evs)
+	return found
+}
+
+// apply writes ops with all involved shards locked, events are sent before unlocking and hooks run afterwards.
+// Every insert is prepared before the first write, so a refused one leaves the map untouched.
+func (m *SafeMapOf[K, V]) apply(ops []txOp[K, V]) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	byShard := make(map[int][]txOp[K, V])
+	for _, op := range ops {
+		i := m.getShardIndex(op.key)
+		byShard[i] = append(byShard[i], op)
+	}
+
+	var evs []eviction[K, V]
+	shards := shardOrder(byShard)
+	m.lockShards(shards)
+	prepared := make(map[K][]byte, len(ops))
+	for _, i := range shards {
+		for _, op := range byShard[i] {
+			if op.e == nil {
+				continue
+			}
+			frame, err := m.prepareLocked(m.shards[i], op.key, op.e)
+			if err != nil {
+				m.unlockShards(shards)
+				return fmt.Errorf("failed to apply batch: %w", err)
+			}
+			prepared[op.key] = frame
+		}
+	}
+	var frames [][]byte
+	if m.wal != nil {
+		for _, i := range shards {
+			m.shards[i].walBatch = &frames
+		}
+	}
+	for _, i := range shards {
+		s := m.shards[i]
+		for _, op := range byShard[i] {
+			if op.e == nil {
+				if e := m.removeLocked(s, op.key); e != nil {
+					m.publishEviction(op.key, e.value, ReasonDeleted)
+					evs = append(evs, eviction[K, V]{op.key, e.value, ReasonDeleted})
+				}
+				continue
+			}
+			oevs, ok := m.storeLocked(s, op.key, op.e, prepared[op.key], false)
+			m.publishAll(oevs)
+			evs = append(evs, oevs...)
+			if ok {
+				m.publish(EventSet, op.key, op.e.value)
+			}
+		}
+	}
+	if m.wal != nil {
+		for _, i := range shards {
+			m.shards[i].walBatch = nil
+		}
+		// written before unlocking so later writes to these keys are logged after it
+		if len(frames) > 0 {
+			m.wal.appendBatch(frames)
+		}
+	}
+	m.unlockShards(shards)
+	m.notifyAll(evs)
+	return nil
+}
+
+// shardOrder returns the shard indexes of byShard sorted, locking in that
+// order means two batches can never wait on each other.
+func shardOrder[T any](byShard map[int]T) []int {
+	shards := make([]int, 0, len(byShard))
+	for i := range byShard {
+		shards = append(shards, i)
+	}
+	slices.Sort(shards)
+	return shards
+}
+
+func (m *SafeMapOf[K, V]) lockShards(shards []int) {
+	for _, i := range shards {
+		m.shards[i].mu.Lock()
+	}
+}
+
+func (m *SafeMapOf[K, V]) unlockShards(shards []int) {
+	for j := len(shards) - 1; j >= 0; j-- {
+		m.shards[shards[j]].mu.Unlock()
+	}
+}
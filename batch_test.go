@@ -0,0 +1,77 @@
+package ez
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMGetDuplicateKeys(t *testing.T) {
+	m := NewSafeMap(4, WithQuiet())
+	defer m.Close()
+	m.Insert("once", 3, "v")
+
+	found := m.MGet("once", "once", "missing", "missing")
+	if found["once"] != "v" || len(found) != 1 {
+		t.Fatalf("MGet = %v, want only once=v", found)
+	}
+	if st := m.Stats(); st.Hits != 1 || st.Misses != 1 {
+		t.Fatalf("Stats() hits=%d misses=%d, want 1 and 1", st.Hits, st.Misses)
+	}
+	// a counter of 3 allows two reads, the duplicated MGet used up only one
+	if _, ok := m.Get("once"); !ok {
+		t.Fatal("key used up by a duplicated MGet")
+	}
+}
+
+func TestBatchRefusedWriteAppliesNothing(t *testing.T) {
+	m := NewSafeMapOf[string, any](1, WithMaxBytes(1000), WithSizer(func(key, value any) int64 {
+		return value.(Sizer).Size()
+	}), WithQuiet())
+	defer m.Close()
+	m.Insert("old", 0, fixedSize(10))
+
+	err := m.Batch(func(tx *TxOf[string, any]) error {
+		tx.Insert("a", 0, fixedSize(10))
+		tx.Delete("old")
+		tx.Insert("huge", 0, fixedSize(2000))
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Batch with a value over the byte budget returned no error")
+	}
+	if _, ok := m.Peek("a"); ok {
+		t.Fatal("refused batch stored a")
+	}
+	if _, ok := m.Peek("old"); !ok {
+		t.Fatal("refused batch deleted old")
+	}
+	if err := m.MSet(map[string]any{"b": fixedSize(10), "huge": fixedSize(2000)}, 0); err == nil {
+		t.Fatal("MSet with a value over the byte budget returned no error")
+	}
+	if m.Len() != 1 {
+		t.Fatalf("Len() = %d after refused MSet, want 1", m.Len())
+	}
+}
+
+func TestBatchAdmitsEveryKeyWithTinyLFU(t *testing.T) {
+	m := NewSafeMapOf[string, int](1, WithMaxEntries(4, EvictTinyLFU), WithQuiet())
+	defer m.Close()
+	for i := 0; i < 4; i++ {
+		m.Insert(fmt.Sprint("hot", i), 0, i)
+		for j := 0; j < 10; j++ {
+			m.Get(fmt.Sprint("hot", i))
+		}
+	}
+	values := map[string]int{"new0": 0, "new1": 1}
+	if err := m.MSet(values, 0); err != nil {
+		t.Fatalf("MSet: %v", err)
+	}
+	for key := range values {
+		if _, ok := m.Peek(key); !ok {
+			t.Fatalf("TinyLFU refused %s from a batch", key)
+		}
+	}
+	if m.Len() != 4 {
+		t.Fatalf("Len() = %d, want the limit of 4", m.Len())
+	}
+}
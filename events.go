@@ -0,0 +1,148 @@
+package ez
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// EventType says what happened to a key
+type EventType int
+
+const (
+	// EventSet means a value was stored under the key
+	EventSet EventType = iota
+	// EventDelete means the key was removed by Delete, Clear or InvalidateTag
+	EventDelete
+	// EventExpire means the TTL of the key ran out
+	EventExpire
+	// EventExhausted means the access counter of the key reached zero
+	EventExhausted
+	// EventEvict means a bounded map evicted the key to make room
+	EventEvict
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	case EventExhausted:
+		return "exhausted"
+	case EventEvict:
+		return "evict"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a keyspace notification sent to subscribers.
+// For removals Value holds the value that was removed.
+type Event[K comparable, V any] struct {
+	Type  EventType
+	Key   K
+	Value V
+}
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before events are dropped.
+const subscriberBuffer = 64
+
+type subscriber[K comparable, V any] struct {
+	pattern string
+	exact   bool
+	key     K
+	ch      chan Event[K, V]
+}
+
+func (s *subscriber[K, V]) matches(key K) bool {
+	if s.exact {
+		return s.key == key
+	}
+	if k, ok := any(key).(string); ok {
+		return globMatch(s.pattern, k)
+	}
+	return globMatch(s.pattern, fmt.Sprint(key))
+}
+
+// Subscribe returns a channel receiving events for keys matching the glob pattern
+// (*, ?, [abc] like Redis). Delivery never blocks the map, when the channel buffer
+// is full new events for that subscriber are dropped. Events are sent while the key
+// is still locked, so the events of one key arrive in the order of its changes.
+// Call Unsubscribe to stop.
+// example usage: for ev := range m.Subscribe("job:*") { fmt.Println(ev.Type, ev.Key) }
+func (m *SafeMapOf[K, V]) Subscribe(pattern string) <-chan Event[K, V] {
+	sub := &subscriber[K, V]{pattern: pattern, ch: make(chan Event[K, V], subscriberBuffer)}
+	m.addSubscriber(sub)
+	return sub.ch
+}
+
+// Unsubscribe stops and closes a channel returned by Subscribe.
+// example usage: m.Unsubscribe(ch)
+func (m *SafeMapOf[K, V]) Unsubscribe(ch <-chan Event[K, V]) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+	for i, sub := range m.subs {
+		if sub.ch == ch {
+			m.subs = slices.Delete(slices.Clone(m.subs), i, i+1)
+			m.hasSubs.Store(len(m.subs) > 0)
+			close(sub.ch)
+			return
+		}
+	}
+}
+
+// Watch blocks until key changes and returns the event, or until ctx is done.
+// example usage: ev, err := m.Watch(ctx, "job:42")
+func (m *SafeMapOf[K, V]) Watch(ctx context.Context, key K) (Event[K, V], error) {
+	sub := &subscriber[K, V]{exact: true, key: key, ch: make(chan Event[K, V], 1)}
+	m.addSubscriber(sub)
+	defer m.Unsubscribe(sub.ch)
+
+	select {
+	case ev := <-sub.ch:
+		return ev, nil
+	case <-ctx.Done():
+		return Event[K, V]{}, ctx.Err()
+	}
+}
+
+func (m *SafeMapOf[K, V]) addSubscriber(sub *subscriber[K, V]) {
+	m.subMu.Lock()
+	// copy on write so publish can range over the slice without holding the lock
+	m.subs = append(slices.Clone(m.subs), sub)
+	m.hasSubs.Store(true)
+	m.subMu.Unlock()
+}
+
+func (m *SafeMapOf[K, V]) publish(kind EventType, key K, value V) {
+	if !m.hasSubs.Load() {
+		return
+	}
+	m.subMu.RLock()
+	defer m.subMu.RUnlock()
+	for _, sub := range m.subs {
+		if !sub.matches(key) {
+			continue
+		}
+		select {
+		case sub.ch <- Event[K, V]{Type: kind, Key: key, Value: value}:
+		default:
+		}
+	}
+}
+
+func (m *SafeMapOf[K, V]) publishEviction(key K, value V, reason EvictReason) {
+	switch reason {
+	case ReasonDeleted, ReasonCleared, ReasonInvalidated:
+		m.publish(EventDelete, key, value)
+	case ReasonExpired:
+		m.publish(EventExpire, key, value)
+	case ReasonExhausted:
+		m.publish(EventExhausted, key, value)
+	case ReasonCapacity:
+		m.publish(EventEvict, key, value)
+	}
+}
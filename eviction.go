@@ -0,0 +1,291 @@
+package ez
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// EvictionPolicy picks which entry a full SafeMap shard drops to make room
+type EvictionPolicy int
+
+const (
+	// EvictNone keeps the SafeMap unbounded, entries only leave through TTL, counters or Delete
+	EvictNone EvictionPolicy = iota
+	// EvictLRU drops the least recently used entry
+	EvictLRU
+	// EvictLFU drops the least frequently used entry, ties go to the oldest
+	EvictLFU
+	// EvictTinyLFU keeps LRU order but only admits a new key when it is used more often than the LRU victim
+	EvictTinyLFU
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictLRU:
+		return "lru"
+	case EvictLFU:
+		return "lfu"
+	case EvictTinyLFU:
+		return "tinylfu"
+	default:
+		return "none"
+	}
+}
+
+// evictor tracks key usage for one shard, every method is called with the shard lock held.
+type evictor[K comparable] interface {
+	add(key K)
+	access(key K)
+	remove(key K)
+	victim() (K, bool)
+	admit(candidate, victim K) bool
+}
+
+// newEvictor returns nil for an unbounded shard. A byte budget without a policy gets LRU.
+func newEvictor[K comparable](policy EvictionPolicy, capacity int, byteBudget bool) evictor[K] {
+	if capacity <= 0 && !byteBudget {
+		return nil
+	}
+	if policy == EvictNone && byteBudget {
+		policy = EvictLRU
+	}
+	if capacity <= 0 {
+		// sketch width for a byte bounded TinyLFU shard
+		capacity = 1024
+	}
+	switch policy {
+	case EvictLRU:
+		return newLRU[K]()
+	case EvictLFU:
+		return newLFU[K]()
+	case EvictTinyLFU:
+		return newTinyLFU[K](capacity)
+	default:
+		return nil
+	}
+}
+
+type lruPolicy[K comparable] struct {
+	order *list.List
+	elems map[K]*list.Element
+}
+
+func newLRU[K comparable]() *lruPolicy[K] {
+	return &lruPolicy[K]{order: list.New(), elems: make(map[K]*list.Element)}
+}
+
+func (p *lruPolicy[K]) add(key K) {
+	if el, ok := p.elems[key]; ok {
+		p.order.MoveToFront(el)
+		return
+	}
+	p.elems[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy[K]) access(key K) {
+	if el, ok := p.elems[key]; ok {
+		p.order.MoveToFront(el)
+	}
+}
+
+func (p *lruPolicy[K]) remove(key K) {
+	if el, ok := p.elems[key]; ok {
+		p.order.Remove(el)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy[K]) victim() (K, bool) {
+	el := p.order.Back()
+	if el == nil {
+		var zero K
+		return zero, false
+	}
+	return el.Value.(K), true
+}
+
+func (p *lruPolicy[K]) admit(candidate, victim K) bool {
+	return true
+}
+
+type lfuItem[K comparable] struct {
+	key   K
+	freq  uint64
+	tick  uint64
+	index int
+}
+
+// lfuHeap is a min heap on (freq, tick) so the least used and then oldest key sits on top.
+type lfuHeap[K comparable] []*lfuItem[K]
+
+func (h lfuHeap[K]) Len() int { return len(h) }
+func (h lfuHeap[K]) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].freq < h[j].freq
+}
+func (h lfuHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *lfuHeap[K]) Push(x any) {
+	item := x.(*lfuItem[K])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *lfuHeap[K]) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+type lfuPolicy[K comparable] struct {
+	heap  lfuHeap[K]
+	items map[K]*lfuItem[K]
+	tick  uint64
+}
+
+func newLFU[K comparable]() *lfuPolicy[K] {
+	return &lfuPolicy[K]{items: make(map[K]*lfuItem[K])}
+}
+
+func (p *lfuPolicy[K]) add(key K) {
+	if _, ok := p.items[key]; ok {
+		p.access(key)
+		return
+	}
+	p.tick++
+	item := &lfuItem[K]{key: key, freq: 1, tick: p.tick}
+	p.items[key] = item
+	heap.Push(&p.heap, item)
+}
+
+func (p *lfuPolicy[K]) access(key K) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+	p.tick++
+	item.freq++
+	item.tick = p.tick
+	heap.Fix(&p.heap, item.index)
+}
+
+func (p *lfuPolicy[K]) remove(key K) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&p.heap, item.index)
+	delete(p.items, key)
+}
+
+func (p *lfuPolicy[K]) victim() (K, bool) {
+	if len(p.heap) == 0 {
+		var zero K
+		return zero, false
+	}
+	return p.heap[0].key, true
+}
+
+func (p *lfuPolicy[K]) admit(candidate, victim K) bool {
+	return true
+}
+
+// tinyLFUPolicy orders entries by recency and uses a count-min sketch of recent
+// key frequencies as an admission filter, so one-hit keys cannot flush hot ones.
+type tinyLFUPolicy[K comparable] struct {
+	lru    *lruPolicy[K]
+	sketch *cmSketch
+}
+
+func newTinyLFU[K comparable](capacity int) *tinyLFUPolicy[K] {
+	return &tinyLFUPolicy[K]{lru: newLRU[K](), sketch: newCMSketch(capacity)}
+}
+
+func (p *tinyLFUPolicy[K]) add(key K) {
+	p.lru.add(key)
+}
+
+func (p *tinyLFUPolicy[K]) access(key K) {
+	p.sketch.increment(hashKey(key))
+	p.lru.access(key)
+}
+
+func (p *tinyLFUPolicy[K]) remove(key K) {
+	p.lru.remove(key)
+}
+
+func (p *tinyLFUPolicy[K]) victim() (K, bool) {
+	return p.lru.victim()
+}
+
+func (p *tinyLFUPolicy[K]) admit(candidate, victim K) bool {
+	h := hashKey(candidate)
+	p.sketch.increment(h)
+	return p.sketch.estimate(h) > p.sketch.estimate(hashKey(victim))
+}
+
+const cmDepth = 4
+
+// cmSketch is a count-min sketch with saturating 8 bit counters.
+// All counters are halved every sample increments so old popularity fades out.
+type cmSketch struct {
+	rows   [cmDepth][]uint8
+	mask   uint64
+	adds   int
+	sample int
+}
+
+func newCMSketch(capacity int) *cmSketch {
+	width := 64
+	for width < capacity*4 {
+		width <<= 1
+	}
+	s := &cmSketch{mask: uint64(width - 1), sample: width * 10}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *cmSketch) index(h uint64, row int) uint64 {
+	return mixHash(h+uint64(row)*0x9e3779b97f4a7c15) & s.mask
+}
+
+func (s *cmSketch) increment(h uint64) {
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < 255 {
+			s.rows[i][idx]++
+		}
+	}
+	s.adds++
+	if s.adds >= s.sample {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) estimate(h uint64) uint8 {
+	min := uint8(255)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.adds = 0
+}
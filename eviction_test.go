@@ -0,0 +1,105 @@
+package ez
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvictLRUDropsLeastRecentlyUsed(t *testing.T) {
+	m := NewSafeMapOf[string, int](1, WithMaxEntries(3, EvictLRU), WithQuiet())
+	defer m.Close()
+	m.Insert("a", 0, 1)
+	m.Insert("b", 0, 2)
+	m.Insert("c", 0, 3)
+	m.Get("a")
+	m.Insert("d", 0, 4)
+	if _, ok := m.Peek("b"); ok {
+		t.Fatal("b survived, want it evicted as least recently used")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := m.Peek(key); !ok {
+			t.Fatalf("%s was evicted, want only b gone", key)
+		}
+	}
+}
+
+func TestEvictLFUDropsLeastFrequentlyUsed(t *testing.T) {
+	m := NewSafeMapOf[string, int](1, WithMaxEntries(3, EvictLFU), WithQuiet())
+	defer m.Close()
+	m.Insert("a", 0, 1)
+	m.Insert("b", 0, 2)
+	m.Insert("c", 0, 3)
+	for i := 0; i < 3; i++ {
+		m.Get("a")
+	}
+	m.Get("b")
+	m.Insert("d", 0, 4)
+	if _, ok := m.Peek("c"); ok {
+		t.Fatal("c survived, want it evicted as least frequently used")
+	}
+	// d and b now tie with c gone, so the older b goes next
+	m.Get("d")
+	m.Insert("e", 0, 5)
+	if _, ok := m.Peek("b"); ok {
+		t.Fatal("b survived a tie with the newer d")
+	}
+	if m.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", m.Len())
+	}
+}
+
+func TestLFUPolicyOrder(t *testing.T) {
+	p := newLFU[string]()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		p.add(key)
+	}
+	p.access("a")
+	p.access("a")
+	p.access("c")
+	p.remove("b")
+
+	var order []string
+	for {
+		key, ok := p.victim()
+		if !ok {
+			break
+		}
+		order = append(order, key)
+		p.remove(key)
+	}
+	if got := fmt.Sprint(order); got != "[d c a]" {
+		t.Fatalf("eviction order = %s, want [d c a]", got)
+	}
+}
+
+func TestEvictTinyLFUAdmission(t *testing.T) {
+	m := NewSafeMapOf[string, int](1, WithMaxEntries(2, EvictTinyLFU), WithQuiet())
+	defer m.Close()
+	m.Insert("hot1", 0, 1)
+	m.Insert("hot2", 0, 2)
+	for i := 0; i < 5; i++ {
+		m.Get("hot1")
+		m.Get("hot2")
+	}
+
+	m.Insert("cold", 0, 3)
+	if _, ok := m.Peek("cold"); ok {
+		t.Fatal("TinyLFU admitted a one-hit key over hot ones")
+	}
+	if m.Len() != 2 {
+		t.Fatalf("Len() = %d after a refused insert, want 2", m.Len())
+	}
+
+	// every attempt counts, a key asked for often enough gets in
+	admitted := false
+	for i := 0; i < 20 && !admitted; i++ {
+		m.Insert("cold", 0, 3)
+		_, admitted = m.Peek("cold")
+	}
+	if !admitted {
+		t.Fatal("TinyLFU never admitted a key inserted 20 times")
+	}
+	if m.Len() != 2 {
+		t.Fatalf("Len() = %d after admission, want 2", m.Len())
+	}
+}
@@ -0,0 +1,65 @@
+package ez
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryItem is the heap slot of one entry, at may be earlier than the entry's
+// expire when a sliding entry or Touch pushed the deadline back.
+type expiryItem[K comparable, V any] struct {
+	at  time.Time
+	key K
+	e   *entry[V]
+}
+
+// expiryHeap is a per shard min heap of deadlines with at most one item per entry.
+// entry.heapIndex points back at the item so removal and replacement are O(log n).
+type expiryHeap[K comparable, V any] []*expiryItem[K, V]
+
+func (h expiryHeap[K, V]) Len() int           { return len(h) }
+func (h expiryHeap[K, V]) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h expiryHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].e.heapIndex = i + 1
+	h[j].e.heapIndex = j + 1
+}
+func (h *expiryHeap[K, V]) Push(x any) {
+	item := x.(*expiryItem[K, V])
+	*h = append(*h, item)
+	item.e.heapIndex = len(*h)
+}
+func (h *expiryHeap[K, V]) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.e.heapIndex = 0
+	*h = old[:n-1]
+	return item
+}
+
+// schedule puts the deadline of e on the heap, the shard lock must be held.
+// An entry without expiry leaves the heap. A later deadline than the queued one
+// keeps the old item, CleanExpired pushes it back when it comes up.
+func (s *shard[K, V]) schedule(key K, e *entry[V]) {
+	if e.expire.IsZero() {
+		s.unschedule(e)
+		return
+	}
+	if e.heapIndex > 0 {
+		if item := s.expiries[e.heapIndex-1]; e.expire.Before(item.at) {
+			item.at = e.expire
+			heap.Fix(&s.expiries, e.heapIndex-1)
+		}
+		return
+	}
+	heap.Push(&s.expiries, &expiryItem[K, V]{at: e.expire, key: key, e: e})
+}
+
+// unschedule drops the heap item of e, the shard lock must be held.
+func (s *shard[K, V]) unschedule(e *entry[V]) {
+	if e.heapIndex > 0 {
+		heap.Remove(&s.expiries, e.heapIndex-1)
+	}
+}
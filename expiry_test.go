@@ -0,0 +1,211 @@
+package ez
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for WithClock
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func queued[K comparable, V any](m *SafeMapOf[K, V]) int {
+	n := 0
+	for _, s := range m.shards {
+		s.mu.Lock()
+		n += len(s.expiries)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+func TestExpiryHeapOneItemPerKey(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := NewSafeMapOf[string, int](1, WithClock(clock.Now), WithJanitorInterval(0), WithQuiet())
+	defer m.Close()
+
+	for i := 0; i < 100; i++ {
+		m.InsertWithTTL("a", time.Duration(100-i)*time.Second, 0, i)
+	}
+	if n := queued(m); n != 1 {
+		t.Fatalf("heap holds %d items after overwrites, want 1", n)
+	}
+	m.Update("a", func(old int, ok bool) (int, bool) { return old + 1, true })
+	if n := queued(m); n != 1 {
+		t.Fatalf("heap holds %d items after Update, want 1", n)
+	}
+	m.Touch("a", time.Hour)
+	if n := queued(m); n != 1 {
+		t.Fatalf("heap holds %d items after Touch, want 1", n)
+	}
+	m.Persist("a")
+	if n := queued(m); n != 0 {
+		t.Fatalf("heap holds %d items after Persist, want 0", n)
+	}
+	m.InsertWithTTL("a", time.Minute, 0, 1)
+	m.Insert("a", 0, 2)
+	if n := queued(m); n != 0 {
+		t.Fatalf("heap holds %d items after overwrite without TTL, want 0", n)
+	}
+	m.InsertWithTTL("b", time.Minute, 0, 1)
+	m.Delete("b")
+	if n := queued(m); n != 0 {
+		t.Fatalf("heap holds %d items after Delete, want 0", n)
+	}
+}
+
+func TestCleanExpiredRemovesDueEntries(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := NewSafeMapOf[string, int](4, WithClock(clock.Now), WithJanitorInterval(0), WithQuiet())
+	defer m.Close()
+
+	m.InsertWithTTL("short", time.Second, 0, 1)
+	m.InsertWithTTL("long", time.Hour, 0, 2)
+	m.Insert("forever", 0, 3)
+
+	clock.Add(2 * time.Second)
+	m.CleanExpired()
+	if _, ok := m.Get("short"); ok {
+		t.Fatal("short is still present after its TTL")
+	}
+	if m.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", m.Len())
+	}
+	if n := queued(m); n != 1 {
+		t.Fatalf("heap holds %d items, want 1", n)
+	}
+}
+
+func TestCleanExpiredReschedulesSliding(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := NewSafeMapOf[string, int](1, WithClock(clock.Now), WithJanitorInterval(0), WithQuiet())
+	defer m.Close()
+
+	m.InsertSliding("s", 10*time.Second, 0, 1)
+	clock.Add(8 * time.Second)
+	if _, ok := m.Get("s"); !ok {
+		t.Fatal("sliding entry missing before its TTL")
+	}
+	// the original deadline has passed but the Get pushed it back
+	clock.Add(5 * time.Second)
+	m.CleanExpired()
+	if _, ok := m.Peek("s"); !ok {
+		t.Fatal("sliding entry removed although it was used")
+	}
+	if n := queued(m); n != 1 {
+		t.Fatalf("heap holds %d items, want 1", n)
+	}
+	clock.Add(10 * time.Second)
+	m.CleanExpired()
+	if m.Len() != 0 || queued(m) != 0 {
+		t.Fatalf("Len() = %d, heap = %d after idle TTL, want 0 and 0", m.Len(), queued(m))
+	}
+}
+
+func TestJanitorLifecycle(t *testing.T) {
+	m := NewSafeMapOf[string, int](4, WithJanitorInterval(5*time.Millisecond), WithQuiet())
+	m.InsertWithTTL("a", time.Millisecond, 0, 1)
+	deadline := time.Now().Add(time.Second)
+	for m.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not sweep an expired entry within a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	m.InsertWithTTL("b", time.Millisecond, 0, 2)
+	time.Sleep(30 * time.Millisecond)
+	if m.Len() != 1 {
+		t.Fatalf("Len() = %d after Close, want the janitor stopped and the entry kept", m.Len())
+	}
+	if _, ok := m.Get("b"); ok {
+		t.Fatal("Get returned an expired entry after Close")
+	}
+
+	off := NewSafeMapOf[string, int](4, WithJanitorInterval(0), WithQuiet())
+	defer off.Close()
+	if off.janitor != nil {
+		t.Fatal("WithJanitorInterval(0) started a janitor")
+	}
+}
+
+func TestTTLTouchAndPersist(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := NewSafeMapOf[string, int](1, WithClock(clock.Now), WithJanitorInterval(0), WithQuiet())
+	defer m.Close()
+
+	m.InsertWithTTL("k", 10*time.Second, 0, 1)
+	m.Insert("forever", 0, 2)
+	clock.Add(4 * time.Second)
+	if left, ok := m.TTL("k"); !ok || left != 6*time.Second {
+		t.Fatalf("TTL(k) = %v, %v, want 6s, true", left, ok)
+	}
+	if left, ok := m.TTL("forever"); !ok || left != NoTTL {
+		t.Fatalf("TTL(forever) = %v, %v, want NoTTL, true", left, ok)
+	}
+	if _, ok := m.TTL("missing"); ok {
+		t.Fatal("TTL(missing) reported a key")
+	}
+
+	if !m.Touch("k", time.Minute) {
+		t.Fatal("Touch(k) = false on a live key")
+	}
+	if left, _ := m.TTL("k"); left != time.Minute {
+		t.Fatalf("TTL(k) after Touch = %v, want 1m", left)
+	}
+	if !m.Persist("k") {
+		t.Fatal("Persist(k) = false on a live key")
+	}
+	clock.Add(time.Hour)
+	m.CleanExpired()
+	if left, ok := m.TTL("k"); !ok || left != NoTTL {
+		t.Fatalf("TTL(k) after Persist = %v, %v, want NoTTL, true", left, ok)
+	}
+
+	m.InsertWithTTL("old", time.Second, 0, 3)
+	clock.Add(2 * time.Second)
+	if m.Touch("old", time.Minute) || m.Persist("old") {
+		t.Fatal("Touch or Persist revived an expired key")
+	}
+}
+
+func TestTouchSlidingWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := NewSafeMapOf[string, int](1, WithClock(clock.Now), WithJanitorInterval(0), WithQuiet())
+	defer m.Close()
+
+	m.InsertSliding("s", 10*time.Second, 0, 1)
+	m.Touch("s", 30*time.Second)
+	clock.Add(20 * time.Second)
+	if _, ok := m.Get("s"); !ok {
+		t.Fatal("sliding entry missing inside its new window")
+	}
+	if left, _ := m.TTL("s"); left != 30*time.Second {
+		t.Fatalf("TTL(s) after Get = %v, want the new 30s window", left)
+	}
+	clock.Add(31 * time.Second)
+	if _, ok := m.Get("s"); ok {
+		t.Fatal("sliding entry outlived its idle window")
+	}
+}
@@ -0,0 +1,145 @@
+package ez
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+)
+
+// HotKey is a frequently used key with its approximate recent access count
+type HotKey[K comparable] struct {
+	Key   K
+	Count uint64
+}
+
+// WithHotKeys tracks the k most used keys of every shard for HotKeys.
+// Get and InsertWithTTL feed a count-min sketch, counts halve over time so old traffic fades out.
+// example usage: m := ez.NewSafeMap(16, ez.WithHotKeys(32))
+func WithHotKeys(k int) SafeMapOption {
+	return func(c *safeMapConfig) {
+		c.hotKeys = k
+	}
+}
+
+// HotKeys returns up to n of the most used keys, busiest first.
+// It returns nil when the map was not created with WithHotKeys.
+// example usage: for _, hk := range m.HotKeys(10) { fmt.Println(hk.Key, hk.Count) }
+func (m *SafeMapOf[K, V]) HotKeys(n int) []HotKey[K] {
+	var all []HotKey[K]
+	for _, s := range m.shards {
+		s.mu.Lock()
+		if s.hot == nil {
+			s.mu.Unlock()
+			return nil
+		}
+		for _, item := range s.hot.top {
+			all = append(all, HotKey[K]{Key: item.key, Count: uint64(item.count)})
+		}
+		s.mu.Unlock()
+	}
+	// a hot key lives in exactly one shard, so merging the per shard lists is exact
+	slices.SortFunc(all, func(a, b HotKey[K]) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	if n >= 0 && len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+type hotItem[K comparable] struct {
+	key   K
+	count uint32
+	index int
+}
+
+// hotHeap is a min heap on count so the coldest tracked key is replaced first.
+type hotHeap[K comparable] []*hotItem[K]
+
+func (h hotHeap[K]) Len() int           { return len(h) }
+func (h hotHeap[K]) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h hotHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *hotHeap[K]) Push(x any) {
+	item := x.(*hotItem[K])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *hotHeap[K]) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// hotTracker is the heavy hitter state of one shard, guarded by the shard lock.
+// The cmSketch of the eviction policies saturates at 255, far too low here,
+// so this one keeps 32 bit counters.
+type hotTracker[K comparable] struct {
+	k      int
+	rows   [cmDepth][]uint32
+	mask   uint64
+	adds   int
+	sample int
+	top    hotHeap[K]
+	items  map[K]*hotItem[K]
+}
+
+func newHotTracker[K comparable](k int) *hotTracker[K] {
+	width := 1024
+	t := &hotTracker[K]{k: k, mask: uint64(width - 1), sample: width * 16, items: make(map[K]*hotItem[K], k)}
+	for i := range t.rows {
+		t.rows[i] = make([]uint32, width)
+	}
+	return t
+}
+
+func (t *hotTracker[K]) record(key K) {
+	h := hashKey(key)
+	est := uint32(1<<32 - 1)
+	for i := range t.rows {
+		idx := mixHash(h+uint64(i)*0x9e3779b97f4a7c15) & t.mask
+		if t.rows[i][idx] < 1<<32-1 {
+			t.rows[i][idx]++
+		}
+		est = min(est, t.rows[i][idx])
+	}
+
+	if item, ok := t.items[key]; ok {
+		item.count = est
+		heap.Fix(&t.top, item.index)
+	} else if len(t.top) < t.k {
+		item := &hotItem[K]{key: key, count: est}
+		t.items[key] = item
+		heap.Push(&t.top, item)
+	} else if est > t.top[0].count {
+		coldest := t.top[0]
+		delete(t.items, coldest.key)
+		coldest.key, coldest.count = key, est
+		t.items[key] = coldest
+		heap.Fix(&t.top, 0)
+	}
+
+	t.adds++
+	if t.adds >= t.sample {
+		t.decay()
+	}
+}
+
+// decay halves every counter, the heap order survives because all counts halve together.
+func (t *hotTracker[K]) decay() {
+	for i := range t.rows {
+		for j := range t.rows[i] {
+			t.rows[i][j] >>= 1
+		}
+	}
+	for _, item := range t.top {
+		item.count >>= 1
+	}
+	t.adds = 0
+}
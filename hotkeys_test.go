@@ -0,0 +1,68 @@
+package ez
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHotKeys(t *testing.T) {
+	plain := NewSafeMapOf[string, int](4, WithQuiet())
+	defer plain.Close()
+	if hk := plain.HotKeys(3); hk != nil {
+		t.Fatalf("HotKeys without WithHotKeys = %v, want nil", hk)
+	}
+
+	m := NewSafeMapOf[string, int](4, WithHotKeys(3), WithQuiet())
+	defer m.Close()
+	for key, n := range map[string]int{"a": 100, "b": 50, "c": 20} {
+		m.Insert(key, 0, n)
+		for i := 0; i < n; i++ {
+			m.Get(key)
+		}
+	}
+	for i := 0; i < 500; i++ {
+		m.Get(fmt.Sprint("cold", i))
+	}
+
+	hot := m.HotKeys(3)
+	if len(hot) != 3 {
+		t.Fatalf("HotKeys(3) returned %d keys, want 3", len(hot))
+	}
+	for i, want := range []struct {
+		key   string
+		count uint64
+	}{{"a", 100}, {"b", 50}, {"c", 20}} {
+		// the sketch may overcount, never undercount
+		if hot[i].Key != want.key || hot[i].Count < want.count {
+			t.Fatalf("HotKeys(3)[%d] = %+v, want %s with at least %d uses", i, hot[i], want.key, want.count)
+		}
+	}
+	if top := m.HotKeys(1); len(top) != 1 || top[0].Key != "a" {
+		t.Fatalf("HotKeys(1) = %v, want only a", top)
+	}
+}
+
+func TestHotTrackerReplacesAndDecays(t *testing.T) {
+	tr := newHotTracker[string](2)
+	for i := 0; i < 10; i++ {
+		tr.record("a")
+	}
+	tr.record("b")
+	for i := 0; i < 3; i++ {
+		tr.record("c")
+	}
+	if _, ok := tr.items["b"]; ok {
+		t.Fatal("b is still tracked after the hotter c arrived")
+	}
+	if tr.items["c"] == nil || tr.items["a"].count != 10 {
+		t.Fatalf("tracked %v, want a with 10 and c", tr.items)
+	}
+
+	tr.decay()
+	if n := tr.items["a"].count; n != 5 {
+		t.Fatalf("count of a after decay = %d, want 5", n)
+	}
+	if tr.top[0].key != "c" {
+		t.Fatalf("coldest tracked key after decay = %s, want c", tr.top[0].key)
+	}
+}
@@ -0,0 +1,198 @@
+package ez
+
+import (
+	"fmt"
+	"iter"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bytedance/gopkg/lang/fastrand"
+)
+
+const (
+	skipMaxLevel = 24
+	// scanBatch is how many keys a scan takes from the index per lock
+	scanBatch = 256
+)
+
+// keyText is the text a key is ordered by, string keys sort as themselves.
+func keyText[K comparable](key K) string {
+	if s, ok := any(key).(string); ok {
+		return s
+	}
+	return fmt.Sprint(key)
+}
+
+type skipNode[K comparable] struct {
+	text string
+	key  K
+	next []*skipNode[K]
+}
+
+// skipList keeps the keys of a SafeMap in lexical order, it runs under the shard lock of the key.
+type skipList[K comparable] struct {
+	mu    sync.RWMutex
+	head  *skipNode[K]
+	level int
+}
+
+func newSkipList[K comparable]() *skipList[K] {
+	return &skipList[K]{head: &skipNode[K]{next: make([]*skipNode[K], skipMaxLevel)}, level: 1}
+}
+
+func randomSkipLevel() int {
+	level := 1
+	for level < skipMaxLevel && fastrand.Uint32n(4) == 0 {
+		level++
+	}
+	return level
+}
+
+func (l *skipList[K]) insert(text string, key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var update [skipMaxLevel]*skipNode[K]
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].text < text {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	for n := x.next[0]; n != nil && n.text == text; n = n.next[0] {
+		if n.key == key {
+			return
+		}
+	}
+
+	level := randomSkipLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+		}
+		l.level = level
+	}
+	node := &skipNode[K]{text: text, key: key, next: make([]*skipNode[K], level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+}
+
+func (l *skipList[K]) remove(text string, key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var update [skipMaxLevel]*skipNode[K]
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].text < text {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	// walk past other keys that print the same, only non string keys can collide
+	target := x.next[0]
+	for target != nil && target.text == text && target.key != key {
+		for i := 0; i < len(target.next); i++ {
+			update[i] = target
+		}
+		target = target.next[0]
+	}
+	if target == nil || target.text != text {
+		return
+	}
+	for i := 0; i < len(target.next); i++ {
+		if update[i].next[i] == target {
+			update[i].next[i] = target.next[i]
+		}
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+}
+
+// batch returns up to n keys ordered from start, skipping start itself unless inclusive.
+func (l *skipList[K]) batch(start string, inclusive bool, n int) []*skipNode[K] {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && (x.next[i].text < start || (!inclusive && x.next[i].text == start)) {
+			x = x.next[i]
+		}
+	}
+	out := make([]*skipNode[K], 0, n)
+	for node := x.next[0]; node != nil && len(out) < n; node = node.next[0] {
+		out = append(out, &skipNode[K]{text: node.text, key: node.key})
+	}
+	return out
+}
+
+// ScanPrefix iterates in lexical key order over live entries whose key starts with prefix.
+// Non string keys are ordered by their %v text. Access counters are not touched.
+// Without WithOrderedIndex the keys are collected and sorted first.
+// example usage: for key, value := range m.ScanPrefix("session:user42:") { fmt.Println(key, value) }
+func (m *SafeMapOf[K, V]) ScanPrefix(prefix string) iter.Seq2[K, V] {
+	return m.scan(prefix, func(text string) bool {
+		return strings.HasPrefix(text, prefix)
+	})
+}
+
+// Range iterates in lexical key order over live entries with from <= key < to.
+// An empty to means no upper bound.
+// example usage: for key, value := range m.Range("a", "n") { fmt.Println(key, value) }
+func (m *SafeMapOf[K, V]) Range(from, to string) iter.Seq2[K, V] {
+	return m.scan(from, func(text string) bool {
+		return to == "" || text < to
+	})
+}
+
+// scan yields entries from start onwards while within reports true.
+func (m *SafeMapOf[K, V]) scan(start string, within func(text string) bool) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if m.index == nil {
+			m.scanSorted(start, within, yield)
+			return
+		}
+		cursor, inclusive := start, true
+		for {
+			nodes := m.index.batch(cursor, inclusive, scanBatch)
+			for _, n := range nodes {
+				if !within(n.text) {
+					return
+				}
+				if v, ok := m.Peek(n.key); ok {
+					if !yield(n.key, v) {
+						return
+					}
+				}
+			}
+			if len(nodes) < scanBatch {
+				return
+			}
+			cursor, inclusive = nodes[len(nodes)-1].text, false
+		}
+	}
+}
+
+func (m *SafeMapOf[K, V]) scanSorted(start string, within func(text string) bool, yield func(K, V) bool) {
+	type item struct {
+		text  string
+		key   K
+		value V
+	}
+	var items []item
+	for key, value := range m.All() {
+		text := keyText(key)
+		if text >= start && within(text) {
+			items = append(items, item{text, key, value})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].text < items[j].text })
+	for _, it := range items {
+		if !yield(it.key, it.value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package ez
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func scanKeys[K comparable, V any](seq func(yield func(K, V) bool)) []K {
+	var keys []K
+	for key := range seq {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestScanOrderAcrossBatches(t *testing.T) {
+	n := 3*scanBatch + 17
+	for _, ordered := range []bool{true, false} {
+		opts := []SafeMapOption{WithQuiet()}
+		if ordered {
+			opts = append(opts, WithOrderedIndex())
+		}
+		m := NewSafeMapOf[string, int](8, opts...)
+		for _, i := range rand.Perm(n) {
+			m.Insert(fmt.Sprintf("user:%05d", i), 0, i)
+			m.Insert(fmt.Sprintf("post:%05d", i), 0, i)
+		}
+		for i := 0; i < n; i += 3 {
+			m.Delete(fmt.Sprintf("user:%05d", i))
+		}
+
+		var want []string
+		for i := 0; i < n; i++ {
+			if i%3 != 0 {
+				want = append(want, fmt.Sprintf("user:%05d", i))
+			}
+		}
+		if got := scanKeys(m.ScanPrefix("user:")); !slices.Equal(got, want) {
+			t.Fatalf("ordered=%v: ScanPrefix returned %d keys, want %d in order", ordered, len(got), len(want))
+		}
+
+		var inRange []string
+		for _, key := range want {
+			if key >= "user:00100" && key < "user:00900" {
+				inRange = append(inRange, key)
+			}
+		}
+		if got := scanKeys(m.Range("user:00100", "user:00900")); !slices.Equal(got, inRange) {
+			t.Fatalf("ordered=%v: Range returned %d keys, want %d in order", ordered, len(got), len(inRange))
+		}
+		if got := scanKeys(m.Range("post:", "")); len(got) != n+len(want) || got[0] != "post:00000" {
+			t.Fatalf("ordered=%v: open Range returned %d keys, want %d from post:00000", ordered, len(got), n+len(want))
+		}
+
+		seen := 0
+		for range m.ScanPrefix("post:") {
+			seen++
+			if seen == scanBatch+1 {
+				break
+			}
+		}
+		if seen != scanBatch+1 {
+			t.Fatalf("ordered=%v: scan went on to %d after break", ordered, seen)
+		}
+		m.Close()
+	}
+}
+
+func TestScanWritesDuringScan(t *testing.T) {
+	m := NewSafeMapOf[string, int](4, WithOrderedIndex(), WithQuiet())
+	defer m.Close()
+	for i := 0; i < 2*scanBatch; i++ {
+		m.Insert(fmt.Sprintf("k:%04d", i), 0, i)
+	}
+	count := 0
+	for key := range m.ScanPrefix("k:") {
+		count++
+		// deleting the current key and writing ahead of the cursor must not break the scan
+		m.Delete(key)
+		if count == 1 {
+			m.Insert("k:9999", 0, -1)
+		}
+	}
+	if count != 2*scanBatch+1 {
+		t.Fatalf("scan yielded %d keys, want %d", count, 2*scanBatch+1)
+	}
+	if m.Len() != 0 {
+		t.Fatalf("Len() = %d, want every key deleted", m.Len())
+	}
+}
@@ -0,0 +1,188 @@
+package ez
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LoaderFunc loads the value for a key on a cache miss and says how long to keep it.
+// A ttl of zero or less keeps the value until it is deleted or evicted.
+type LoaderFunc[K comparable, V any] func(ctx context.Context, key K) (V, time.Duration, error)
+
+// LoadingCache is a read-through cache on top of a SafeMapOf.
+// Concurrent misses for one key share a single loader call.
+type LoadingCache[K comparable, V any] struct {
+	m            *SafeMapOf[K, V]
+	loader       LoaderFunc[K, V]
+	refreshAhead time.Duration
+	loadTimeout  time.Duration
+	group        flightGroup[K, V]
+}
+
+// LoadingOption configures a LoadingCache
+type LoadingOption func(*loadingConfig)
+
+type loadingConfig struct {
+	refreshAhead time.Duration
+	loadTimeout  time.Duration
+}
+
+// WithRefreshAhead reloads an entry in the background once a Get sees less than d of its TTL left.
+// Callers keep getting the current value while the reload runs.
+// example usage: c := ez.NewLoadingCache(m, loader, ez.WithRefreshAhead(10*time.Second))
+func WithRefreshAhead(d time.Duration) LoadingOption {
+	return func(c *loadingConfig) {
+		c.refreshAhead = d
+	}
+}
+
+// WithLoadTimeout cancels the ctx of every loader call after d, background reloads included.
+// Without it a loader only gets the deadline of the Get that started it, if any.
+// example usage: c := ez.NewLoadingCache(m, loader, ez.WithLoadTimeout(5*time.Second))
+func WithLoadTimeout(d time.Duration) LoadingOption {
+	return func(c *loadingConfig) {
+		c.loadTimeout = d
+	}
+}
+
+// NewLoadingCache wraps m so misses are filled by loader.
+// example usage: c := ez.NewLoadingCache(ez.NewSafeMapOf[string, User](16), func(ctx context.Context, id string) (User, time.Duration, error) { return findUser(ctx, id) })
+func NewLoadingCache[K comparable, V any](m *SafeMapOf[K, V], loader LoaderFunc[K, V], opts ...LoadingOption) *LoadingCache[K, V] {
+	cfg := loadingConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &LoadingCache[K, V]{m: m, loader: loader, refreshAhead: cfg.refreshAhead, loadTimeout: cfg.loadTimeout}
+}
+
+// Get returns the cached value for key, calling the loader on a miss.
+// Loader errors are returned and not cached.
+// example usage: user, err := c.Get(ctx, "42")
+func (c *LoadingCache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	if v, ok := c.m.Get(key); ok {
+		if c.refreshAhead > 0 {
+			if left, ok := c.m.TTL(key); ok && left != NoTTL && left <= c.refreshAhead && !c.group.pending(key) {
+				go c.group.do(context.Background(), key, c.load(key))
+			}
+		}
+		return v, nil
+	}
+	return c.group.do(ctx, key, c.load(key))
+}
+
+// Refresh calls the loader for key now and stores the result, even if a value is cached.
+// It never joins a load already running for key, that load may have read the source before the change.
+// example usage: user, err := c.Refresh(ctx, "42")
+func (c *LoadingCache[K, V]) Refresh(ctx context.Context, key K) (V, error) {
+	return c.load(key)(ctx)
+}
+
+// Invalidate drops key so the next Get loads it again.
+// example usage: c.Invalidate("42")
+func (c *LoadingCache[K, V]) Invalidate(key K) {
+	c.m.Delete(key)
+}
+
+// Map returns the SafeMapOf the cache stores its values in.
+func (c *LoadingCache[K, V]) Map() *SafeMapOf[K, V] {
+	return c.m
+}
+
+func (c *LoadingCache[K, V]) load(key K) func(ctx context.Context) (V, error) {
+	return func(ctx context.Context) (V, error) {
+		if c.loadTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.loadTimeout)
+			defer cancel()
+		}
+		v, ttl, err := c.loader(ctx, key)
+		if err != nil {
+			return v, err
+		}
+		c.m.InsertWithTTL(key, ttl, 0, v)
+		return v, nil
+	}
+}
+
+type flightCall[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// flightGroup collapses concurrent calls for the same key into one.
+type flightGroup[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*flightCall[V]
+}
+
+// flightPanic is the error of a call whose fn panicked, value is what it panicked with.
+type flightPanic struct {
+	key   any
+	value any
+}
+
+func (p *flightPanic) Error() string {
+	return fmt.Sprintf("panic while loading key %v: %v", p.key, p.value)
+}
+
+// do runs fn once per key at a time, other callers for that key wait for its result.
+// fn runs detached from the callers' cancellation so one caller giving up does not
+// fail the rest, each caller stops waiting as soon as its own ctx is done.
+// fn keeps the deadline of the first caller, so a stuck call does not block the key forever.
+// A caller whose ctx can never be cancelled runs fn itself instead of in a goroutine.
+func (g *flightGroup[K, V]) do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (V, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*flightCall[V])
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		call = &flightCall[V]{done: make(chan struct{})}
+		g.calls[key] = call
+		if ctx.Done() == nil {
+			g.mu.Unlock()
+			g.run(ctx, key, call, fn)
+			return call.val, call.err
+		}
+		detached, cancel := context.WithoutCancel(ctx), context.CancelFunc(func() {})
+		if dl, ok := ctx.Deadline(); ok {
+			detached, cancel = context.WithDeadline(detached, dl)
+		}
+		go func() {
+			defer cancel()
+			g.run(detached, key, call, fn)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (g *flightGroup[K, V]) run(ctx context.Context, key K, call *flightCall[V], fn func(ctx context.Context) (V, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.err = &flightPanic{key: key, value: r}
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.val, call.err = fn(ctx)
+}
+
+func (g *flightGroup[K, V]) pending(key K) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.calls[key]
+	return ok
+}
@@ -0,0 +1,142 @@
+package ez
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadingCacheSharesMisses(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	c := NewLoadingCache(NewSafeMapOf[string, int](4, WithQuiet()), func(ctx context.Context, key string) (int, time.Duration, error) {
+		calls.Add(1)
+		<-release
+		return 7, 0, nil
+	})
+	defer c.Map().Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get(ctx, "k"); err != nil || v != 7 {
+				t.Errorf("Get = %d, %v, want 7, nil", v, err)
+			}
+		}()
+	}
+	for !c.group.pending("k") {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader ran %d times for concurrent misses, want 1", n)
+	}
+}
+
+func TestLoadingCacheRefreshAhead(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	var calls atomic.Int32
+	reloaded := make(chan struct{}, 1)
+	c := NewLoadingCache(NewSafeMapOf[string, int32](4, WithClock(clock.Now), WithQuiet()), func(ctx context.Context, key string) (int32, time.Duration, error) {
+		n := calls.Add(1)
+		if n > 1 {
+			reloaded <- struct{}{}
+		}
+		return n, time.Minute, nil
+	}, WithRefreshAhead(10*time.Second))
+	defer c.Map().Close()
+
+	ctx := context.Background()
+	c.Get(ctx, "k")
+	clock.Add(30 * time.Second)
+	if v, _ := c.Get(ctx, "k"); v != 1 || calls.Load() != 1 {
+		t.Fatalf("Get with 30s left = %d after %d loads, want 1 without a reload", v, calls.Load())
+	}
+	clock.Add(25 * time.Second)
+	if v, _ := c.Get(ctx, "k"); v != 1 {
+		t.Fatalf("Get with 5s left = %d, want the cached 1 while reloading", v)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("no background reload with 5s of TTL left")
+	}
+	for c.group.pending("k") {
+		time.Sleep(time.Millisecond)
+	}
+	if v, _ := c.Get(ctx, "k"); v != 2 {
+		t.Fatalf("Get after reload = %d, want 2", v)
+	}
+}
+
+func TestLoadingCacheLoadTimeout(t *testing.T) {
+	var calls atomic.Int32
+	c := NewLoadingCache(NewSafeMapOf[string, int](4, WithQuiet()), func(ctx context.Context, key string) (int, time.Duration, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			return 0, 0, ctx.Err()
+		}
+		return 1, 0, nil
+	}, WithLoadTimeout(20*time.Millisecond))
+	defer c.Map().Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := c.Get(ctx, "k"); err == nil {
+		t.Fatal("Get returned no error from a hung loader")
+	}
+	if v, err := c.Get(ctx, "k"); err != nil || v != 1 {
+		t.Fatalf("Get after a timed out load = %d, %v, want 1, nil", v, err)
+	}
+}
+
+func TestLoadingCacheKeepsCallerDeadline(t *testing.T) {
+	c := NewLoadingCache(NewSafeMapOf[string, int](4, WithQuiet()), func(ctx context.Context, key string) (int, time.Duration, error) {
+		<-ctx.Done()
+		return 0, 0, ctx.Err()
+	})
+	defer c.Map().Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	c.Get(ctx, "k")
+	deadline := time.Now().Add(time.Second)
+	for c.group.pending("k") {
+		if time.Now().After(deadline) {
+			t.Fatal("load still running a second after the caller's deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoadingCacheRefreshSkipsInFlightLoad(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	c := NewLoadingCache(NewSafeMapOf[string, int32](4, WithQuiet()), func(ctx context.Context, key string) (int32, time.Duration, error) {
+		n := calls.Add(1)
+		if n == 1 {
+			<-release
+		}
+		return n, 0, nil
+	})
+	defer c.Map().Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Get(ctx, "k")
+	for !c.group.pending("k") {
+		time.Sleep(time.Millisecond)
+	}
+	if v, err := c.Refresh(ctx, "k"); err != nil || v != 2 {
+		t.Fatalf("Refresh during a load = %d, %v, want a new load returning 2", v, err)
+	}
+}
@@ -3,16 +3,20 @@ package ez
 import (
 	"bufio"
 	"bytes"
+	"container/heap"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
+	"hash/maphash"
 	"io"
 	"io/ioutil"
+	"iter"
+	"math"
 	"net/http"
 	"os"
 	"reflect"
-	"runtime"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -220,468 +224,132 @@ type Memorizecache struct {
 	expiry time.Time
 }
 
-var (
-	cacheMu   sync.RWMutex
-	funcCache = make(map[string]interface{})
-)
-
-type cacheEntry[R any] struct {
-	result R
-	expiry time.Time
-}
-
-type cacheEntryE[R1, R2 any] struct {
-	value1 R1
-	value2 R2
-	expiry time.Time
-}
-
 // Memoize a function with no arguments and 1 return value
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise
 // example usage: temp := ez.Memo0(funchere)
-func Memo0[R any](fn func() R) R {
-	key := fmt.Sprintf("%p", fn)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntry[R])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.result
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	res := fn()
-	entry := &cacheEntry[R]{result: res, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return res
+func Memo0[R any](fn func() R, opts ...MemoOption) R {
+	cfg := newMemoConfig(opts)
+	return memoCall(memoCacheFor[struct{}](fn, cfg), struct{}{}, cfg, fn, nil)
 }
 
 // Memoize a function with no arguments and 2 return values
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise, a non-nil error as second value is not cached
 // example usage: temp1, temp2 := ez.Memo0e(funchere)
-func Memo0e[R1, R2 any](fn func() (R1, R2)) (R1, R2) {
-	key := fmt.Sprintf("%p", fn)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntryE[R1, R2])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.value1, entry.value2
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	v1, v2 := fn()
-	entry := &cacheEntryE[R1, R2]{value1: v1, value2: v2, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return v1, v2
+func Memo0e[R1, R2 any](fn func() (R1, R2), opts ...MemoOption) (R1, R2) {
+	cfg := newMemoConfig(opts)
+	return memoCallE(memoCacheFor[struct{}](fn, cfg), struct{}{}, cfg, fn)
 }
 
 // Memoize a function with 1 argument and 1 return value
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise
 // example usage: temp := ez.Memo1(funchere, arg1)
-func Memo1[A comparable, R any](fn func(A) R, arg A) R {
-	key := fmt.Sprintf("%p|%v", fn, arg)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntry[R])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.result
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	res := fn(arg)
-	entry := &cacheEntry[R]{result: res, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return res
+func Memo1[A comparable, R any](fn func(A) R, arg A, opts ...MemoOption) R {
+	cfg := newMemoConfig(opts)
+	return memoCall(memoCacheFor[A](fn, cfg), arg, cfg, func() R { return fn(arg) }, nil)
 }
 
 // Memoize a function with 1 argument and 2 return values
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise, a non-nil error as second value is not cached
 // example usage: temp1, temp2 := ez.Memo1e(funchere, arg1)
-func Memo1e[A comparable, R1, R2 any](fn func(A) (R1, R2), arg A) (R1, R2) {
-	key := fmt.Sprintf("%p|%v", fn, arg)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntryE[R1, R2])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.value1, entry.value2
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	v1, v2 := fn(arg)
-	entry := &cacheEntryE[R1, R2]{value1: v1, value2: v2, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return v1, v2
+func Memo1e[A comparable, R1, R2 any](fn func(A) (R1, R2), arg A, opts ...MemoOption) (R1, R2) {
+	cfg := newMemoConfig(opts)
+	return memoCallE(memoCacheFor[A](fn, cfg), arg, cfg, func() (R1, R2) { return fn(arg) })
 }
 
 // Memoize a function with 2 arguments and 1 return value
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise
 // example usage: temp := ez.Memo2(funchere, arg1, arg2)
-func Memo2[A, B comparable, R any](fn func(A, B) R, arg1 A, arg2 B) R {
-	key := fmt.Sprintf("%p|%v|%v", fn, arg1, arg2)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntry[R])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.result
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	res := fn(arg1, arg2)
-	entry := &cacheEntry[R]{result: res, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return res
+func Memo2[A, B comparable, R any](fn func(A, B) R, arg1 A, arg2 B, opts ...MemoOption) R {
+	cfg := newMemoConfig(opts)
+	return memoCall(memoCacheFor[MemoArgs2[A, B]](fn, cfg), MemoArgs2[A, B]{arg1, arg2}, cfg, func() R { return fn(arg1, arg2) }, nil)
 }
 
 // Memoize a function with 2 arguments and 2 return values
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise, a non-nil error as second value is not cached
 // example usage: temp1, temp2 := ez.Memo2e(funchere, arg1, arg2)
-func Memo2e[A, B comparable, R1, R2 any](fn func(A, B) (R1, R2), arg1 A, arg2 B) (R1, R2) {
-	key := fmt.Sprintf("%p|%v|%v", fn, arg1, arg2)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntryE[R1, R2])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.value1, entry.value2
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	v1, v2 := fn(arg1, arg2)
-	entry := &cacheEntryE[R1, R2]{value1: v1, value2: v2, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return v1, v2
+func Memo2e[A, B comparable, R1, R2 any](fn func(A, B) (R1, R2), arg1 A, arg2 B, opts ...MemoOption) (R1, R2) {
+	cfg := newMemoConfig(opts)
+	return memoCallE(memoCacheFor[MemoArgs2[A, B]](fn, cfg), MemoArgs2[A, B]{arg1, arg2}, cfg, func() (R1, R2) { return fn(arg1, arg2) })
 }
 
 // Memoize a function with 3 arguments and 1 return value
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise
 // example usage: temp := ez.Memo3(funchere, arg1, arg2, arg3)
-func Memo3[A, B, C comparable, R any](fn func(A, B, C) R, a A, b B, c C) R {
-	key := fmt.Sprintf("%p|%v|%v|%v", fn, a, b, c)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntry[R])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.result
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	res := fn(a, b, c)
-	entry := &cacheEntry[R]{result: res, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return res
+func Memo3[A, B, C comparable, R any](fn func(A, B, C) R, a A, b B, c C, opts ...MemoOption) R {
+	cfg := newMemoConfig(opts)
+	return memoCall(memoCacheFor[MemoArgs3[A, B, C]](fn, cfg), MemoArgs3[A, B, C]{a, b, c}, cfg, func() R { return fn(a, b, c) }, nil)
 }
 
 // Memoize a function with 3 arguments and 2 return values
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise, a non-nil error as second value is not cached
 // example usage: temp1, temp2 := ez.Memo3e(funchere, arg1, arg2, arg3)
-func Memo3e[A, B, C comparable, R1, R2 any](fn func(A, B, C) (R1, R2), a A, b B, c C) (R1, R2) {
-	key := fmt.Sprintf("%p|%v|%v|%v", fn, a, b, c)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntryE[R1, R2])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.value1, entry.value2
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	v1, v2 := fn(a, b, c)
-	entry := &cacheEntryE[R1, R2]{value1: v1, value2: v2, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return v1, v2
+func Memo3e[A, B, C comparable, R1, R2 any](fn func(A, B, C) (R1, R2), a A, b B, c C, opts ...MemoOption) (R1, R2) {
+	cfg := newMemoConfig(opts)
+	return memoCallE(memoCacheFor[MemoArgs3[A, B, C]](fn, cfg), MemoArgs3[A, B, C]{a, b, c}, cfg, func() (R1, R2) { return fn(a, b, c) })
 }
 
 // Memoize a function with 4 arguments and 1 return value
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise
 // example usage: temp := ez.Memo4(funchere, arg1, arg2, arg3, arg4)
-func Memo4[A, B, C, D comparable, R any](fn func(A, B, C, D) R, a A, b B, c C, d D) R {
-	key := fmt.Sprintf("%p|%v|%v|%v|%v", fn, a, b, c, d)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntry[R])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.result
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	res := fn(a, b, c, d)
-	entry := &cacheEntry[R]{result: res, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return res
+func Memo4[A, B, C, D comparable, R any](fn func(A, B, C, D) R, a A, b B, c C, d D, opts ...MemoOption) R {
+	cfg := newMemoConfig(opts)
+	return memoCall(memoCacheFor[MemoArgs4[A, B, C, D]](fn, cfg), MemoArgs4[A, B, C, D]{a, b, c, d}, cfg, func() R { return fn(a, b, c, d) }, nil)
 }
 
 // Memoize a function with 4 arguments and 2 return values
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise, a non-nil error as second value is not cached
 // example usage: temp1, temp2 := ez.Memo4e(funchere, arg1, arg2, arg3, arg4)
-func Memo4e[A, B, C, D comparable, R1, R2 any](fn func(A, B, C, D) (R1, R2), a A, b B, c C, d D) (R1, R2) {
-	key := fmt.Sprintf("%p|%v|%v|%v|%v", fn, a, b, c, d)
-	cacheMu.RLock()
-	if e, ok := funcCache[key]; ok {
-		entry := e.(*cacheEntryE[R1, R2])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.value1, entry.value2
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	v1, v2 := fn(a, b, c, d)
-	entry := &cacheEntryE[R1, R2]{value1: v1, value2: v2, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return v1, v2
+func Memo4e[A, B, C, D comparable, R1, R2 any](fn func(A, B, C, D) (R1, R2), a A, b B, c C, d D, opts ...MemoOption) (R1, R2) {
+	cfg := newMemoConfig(opts)
+	return memoCallE(memoCacheFor[MemoArgs4[A, B, C, D]](fn, cfg), MemoArgs4[A, B, C, D]{a, b, c, d}, cfg, func() (R1, R2) { return fn(a, b, c, d) })
 }
 
 // Memoize a function with 5 arguments and 1 return value
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise
 // example usage: temp := ez.Memo5(funchere, arg1, arg2, arg3, arg4, arg5)
-func Memo5[A, B, C, D, E comparable, R any](fn func(A, B, C, D, E) R, a A, b B, c C, d D, e E) R {
-	key := fmt.Sprintf("%p|%v|%v|%v|%v|%v", fn, a, b, c, d, e)
-	cacheMu.RLock()
-	if val, ok := funcCache[key]; ok {
-		entry := val.(*cacheEntry[R])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.result
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	res := fn(a, b, c, d, e)
-	entry := &cacheEntry[R]{result: res, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return res
+func Memo5[A, B, C, D, E comparable, R any](fn func(A, B, C, D, E) R, a A, b B, c C, d D, e E, opts ...MemoOption) R {
+	cfg := newMemoConfig(opts)
+	return memoCall(memoCacheFor[MemoArgs5[A, B, C, D, E]](fn, cfg), MemoArgs5[A, B, C, D, E]{a, b, c, d, e}, cfg, func() R { return fn(a, b, c, d, e) }, nil)
 }
 
 // Memoize a function with 5 arguments and 2 return values
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise, a non-nil error as second value is not cached
 // example usage: temp1, temp2 := ez.Memo5e(funchere, arg1, arg2, arg3, arg4, arg5)
-func Memo5e[A, B, C, D, E comparable, R1, R2 any](fn func(A, B, C, D, E) (R1, R2), a A, b B, c C, d D, e E) (R1, R2) {
-	key := fmt.Sprintf("%p|%v|%v|%v|%v|%v", fn, a, b, c, d, e)
-	cacheMu.RLock()
-	if val, ok := funcCache[key]; ok {
-		entry := val.(*cacheEntryE[R1, R2])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.value1, entry.value2
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	v1, v2 := fn(a, b, c, d, e)
-	entry := &cacheEntryE[R1, R2]{value1: v1, value2: v2, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return v1, v2
+func Memo5e[A, B, C, D, E comparable, R1, R2 any](fn func(A, B, C, D, E) (R1, R2), a A, b B, c C, d D, e E, opts ...MemoOption) (R1, R2) {
+	cfg := newMemoConfig(opts)
+	return memoCallE(memoCacheFor[MemoArgs5[A, B, C, D, E]](fn, cfg), MemoArgs5[A, B, C, D, E]{a, b, c, d, e}, cfg, func() (R1, R2) { return fn(a, b, c, d, e) })
 }
 
 // Memoize a function with 6 arguments and 1 return value
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise
 // example usage: temp := ez.Memo6(funchere, arg1, arg2, arg3, arg4, arg5, arg6)
-func Memo6[A, B, C, D, E, F comparable, R any](fn func(A, B, C, D, E, F) R, a A, b B, c C, d D, e E, f F) R {
-	key := fmt.Sprintf("%p|%v|%v|%v|%v|%v|%v", fn, a, b, c, d, e, f)
-	cacheMu.RLock()
-	if val, ok := funcCache[key]; ok {
-		entry := val.(*cacheEntry[R])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.result
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	res := fn(a, b, c, d, e, f)
-	entry := &cacheEntry[R]{result: res, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return res
+func Memo6[A, B, C, D, E, F comparable, R any](fn func(A, B, C, D, E, F) R, a A, b B, c C, d D, e E, f F, opts ...MemoOption) R {
+	cfg := newMemoConfig(opts)
+	return memoCall(memoCacheFor[MemoArgs6[A, B, C, D, E, F]](fn, cfg), MemoArgs6[A, B, C, D, E, F]{a, b, c, d, e, f}, cfg, func() R { return fn(a, b, c, d, e, f) }, nil)
 }
 
 // Memoize a function with 6 arguments and 2 return values
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise, a non-nil error as second value is not cached
 // example usage: temp1, temp2 := ez.Memo6e(funchere, arg1, arg2, arg3, arg4, arg5, arg6)
-func Memo6e[A, B, C, D, E, F comparable, R1, R2 any](fn func(A, B, C, D, E, F) (R1, R2), a A, b B, c C, d D, e E, f F) (R1, R2) {
-	key := fmt.Sprintf("%p|%v|%v|%v|%v|%v|%v", fn, a, b, c, d, e, f)
-	cacheMu.RLock()
-	if val, ok := funcCache[key]; ok {
-		entry := val.(*cacheEntryE[R1, R2])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.value1, entry.value2
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	v1, v2 := fn(a, b, c, d, e, f)
-	entry := &cacheEntryE[R1, R2]{value1: v1, value2: v2, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return v1, v2
+func Memo6e[A, B, C, D, E, F comparable, R1, R2 any](fn func(A, B, C, D, E, F) (R1, R2), a A, b B, c C, d D, e E, f F, opts ...MemoOption) (R1, R2) {
+	cfg := newMemoConfig(opts)
+	return memoCallE(memoCacheFor[MemoArgs6[A, B, C, D, E, F]](fn, cfg), MemoArgs6[A, B, C, D, E, F]{a, b, c, d, e, f}, cfg, func() (R1, R2) { return fn(a, b, c, d, e, f) })
 }
 
 // Memoize a function with 7 arguments and 1 return value
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise
 // example usage: temp := ez.Memo7(funchere, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
-func Memo7[A, B, C, D, E, F, G comparable, R any](fn func(A, B, C, D, E, F, G) R, a A, b B, c C, d D, e E, f F, g G) R {
-	key := fmt.Sprintf("%p|%v|%v|%v|%v|%v|%v|%v", fn, a, b, c, d, e, f, g)
-	cacheMu.RLock()
-	if val, ok := funcCache[key]; ok {
-		entry := val.(*cacheEntry[R])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.result
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	res := fn(a, b, c, d, e, f, g)
-	entry := &cacheEntry[R]{result: res, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return res
+func Memo7[A, B, C, D, E, F, G comparable, R any](fn func(A, B, C, D, E, F, G) R, a A, b B, c C, d D, e E, f F, g G, opts ...MemoOption) R {
+	cfg := newMemoConfig(opts)
+	return memoCall(memoCacheFor[MemoArgs7[A, B, C, D, E, F, G]](fn, cfg), MemoArgs7[A, B, C, D, E, F, G]{a, b, c, d, e, f, g}, cfg, func() R { return fn(a, b, c, d, e, f, g) }, nil)
 }
 
 // Memoize a function with 7 arguments and 2 return values
-// Has a cache time of 6 seconds
+// Caches for 6 seconds unless a MemoOption says otherwise, a non-nil error as second value is not cached
 // example usage: temp1, temp2 := ez.Memo7e(funchere, arg1, arg2, arg3, arg4, arg5, arg6, arg7)
-func Memo7e[A, B, C, D, E, F, G comparable, R1, R2 any](fn func(A, B, C, D, E, F, G) (R1, R2), a A, b B, c C, d D, e E, f F, g G) (R1, R2) {
-	key := fmt.Sprintf("%p|%v|%v|%v|%v|%v|%v|%v", fn, a, b, c, d, e, f, g)
-	cacheMu.RLock()
-	if val, ok := funcCache[key]; ok {
-		entry := val.(*cacheEntryE[R1, R2])
-		if time.Now().Before(entry.expiry) {
-			cacheMu.RUnlock()
-			return entry.value1, entry.value2
-		}
-		cacheMu.RUnlock()
-		cacheMu.Lock()
-		delete(funcCache, key)
-		cacheMu.Unlock()
-	} else {
-		cacheMu.RUnlock()
-	}
-
-	v1, v2 := fn(a, b, c, d, e, f, g)
-	entry := &cacheEntryE[R1, R2]{value1: v1, value2: v2, expiry: time.Now().Add(6 * time.Second)}
-	cacheMu.Lock()
-	funcCache[key] = entry
-	cacheMu.Unlock()
-	return v1, v2
+func Memo7e[A, B, C, D, E, F, G comparable, R1, R2 any](fn func(A, B, C, D, E, F, G) (R1, R2), a A, b B, c C, d D, e E, f F, g G, opts ...MemoOption) (R1, R2) {
+	cfg := newMemoConfig(opts)
+	return memoCallE(memoCacheFor[MemoArgs7[A, B, C, D, E, F, G]](fn, cfg), MemoArgs7[A, B, C, D, E, F, G]{a, b, c, d, e, f, g}, cfg, func() (R1, R2) { return fn(a, b, c, d, e, f, g) })
 }
 
 // Memorize a function
@@ -833,12 +501,17 @@ func Mongodropdb(client *mongo.Client, dbName string) error {
 	return nil
 }
 
-func Mongocreateindex(client *mongo.Client, dbName, collectionName, field string) error {
+// Create an ascending index on field, the optional index options can make it unique or a TTL index
+// example usage: err := ez.Mongocreateindex(client, "mydb", "mycollection", "expiresAt", options.Index().SetExpireAfterSeconds(0))
+func Mongocreateindex(client *mongo.Client, dbName, collectionName, field string, opts ...*options.IndexOptions) error {
 	collection := client.Database(dbName).Collection(collectionName)
 
 	indexModel := mongo.IndexModel{
 		Keys: bson.D{{Key: field, Value: 1}},
 	}
+	if len(opts) > 0 {
+		indexModel.Options = opts[0]
+	}
 
 	_, err := collection.Indexes().CreateOne(context.TODO(), indexModel)
 	if err != nil {
@@ -851,11 +524,13 @@ func Mongocreateindex(client *mongo.Client, dbName, collectionName, field string
 // Update one document into a collection
 //
 // example usage: ez.Mongoupdate_one(client, "mydb", "mycollection", bson.D{{"name", "John"}}, bson.D{{"$set", bson.D{{"name", "Doe"}}}})
-func Mongoupdate_one(client *mongo.Client, mydb string, mycollection string, filter bson.D, update bson.D) error {
+//
+// example usage: ez.Mongoupdate_one(client, "mydb", "mycollection", filter, update, options.Update().SetUpsert(true))
+func Mongoupdate_one(client *mongo.Client, mydb string, mycollection string, filter bson.D, update bson.D, opts ...*options.UpdateOptions) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	collection := client.Database(mydb).Collection(mycollection)
-	_, err := collection.UpdateOne(ctx, filter, update)
+	_, err := collection.UpdateOne(ctx, filter, update, opts...)
 	if err != nil {
 		return err
 	}
@@ -1550,21 +1225,158 @@ func TraceJson(url string, headers map[string]string) (map[string]interface{}, e
 	return ParseJson(Body)
 }
 
-type SafeMap struct {
-	shards  []*sync.Map
+// SafeMapOf is a sharded, concurrency safe map with optional TTL and access counters.
+// Keys can be any comparable type and Get returns V directly, no type assertions needed.
+// example usage: m := ez.NewSafeMapOf[int, User](16)
+type SafeMapOf[K comparable, V any] struct {
+	shards  []*shard[K, V]
 	size    atomic.Uint32
 	janitor *janitor
+
+	mu       sync.RWMutex
+	onEvict  []func(key K, value V, reason EvictReason)
+	replaced bool
+	codec    ValueCodec[V]
+	stats    mapStats
+
+	now       func() time.Time
+	closeOnce sync.Once
+
+	tagMu sync.Mutex
+	tags  map[string]map[K]struct{}
+
+	wal *walLog[K, V]
+
+	subMu   sync.RWMutex
+	subs    []*subscriber[K, V]
+	hasSubs atomic.Bool
+
+	index *skipList[K]
+
+	bytes atomic.Int64
+	sizer func(key, value any) int64
 }
 
-type entry struct {
-	value      interface{}
+// SafeMap is the original string keyed map holding interface{} values.
+// It is a SafeMapOf[string, interface{}] so every method is shared.
+// example usage: m := ez.NewSafeMap(16)
+type SafeMap = SafeMapOf[string, interface{}]
+
+type shard[K comparable, V any] struct {
+	mu       sync.Mutex
+	items    map[K]*entry[V]
+	max      int
+	maxBytes int64
+	bytes    int64
+	policy   evictor[K]
+	expiries expiryHeap[K, V]
+	hot      *hotTracker[K]
+	walBatch *[][]byte // set while a Batch holds the lock, collects its log records
+}
+
+type entry[V any] struct {
+	value      V
 	expire     time.Time
+	sliding    time.Duration
+	heapIndex  int // 1 based slot in the shard expiry heap, 0 when not queued
+	size       int64
+	tags       []string
 	getcounter atomic.Uint32
 }
 
 type janitor struct {
 	interval time.Duration
-	stop     chan bool
+	stop     chan struct{}
+}
+
+// SafeMapOption configures a SafeMap at construction time.
+type SafeMapOption func(*safeMapConfig)
+
+type safeMapConfig struct {
+	maxEntries int
+	policy     EvictionPolicy
+	interval   time.Duration
+	quiet      bool
+	clock      func() time.Time
+	ordered    bool
+	maxBytes   int64
+	sizer      func(key, value any) int64
+	hotKeys    int
+	replaced   bool
+}
+
+// WithMaxEntries bounds the SafeMap to roughly n entries.
+// The limit is split evenly over the shards and each shard evicts with the given policy once full.
+// example usage: m := ez.NewSafeMap(16, ez.WithMaxEntries(100000, ez.EvictLRU))
+func WithMaxEntries(n int, policy EvictionPolicy) SafeMapOption {
+	return func(c *safeMapConfig) {
+		c.maxEntries = n
+		c.policy = policy
+	}
+}
+
+// WithJanitorInterval sets how often expired entries are cleaned, 30 seconds by default.
+// Zero or less disables the janitor, CleanExpired can then be called by hand.
+// example usage: m := ez.NewSafeMap(16, ez.WithJanitorInterval(5*time.Second))
+func WithJanitorInterval(d time.Duration) SafeMapOption {
+	return func(c *safeMapConfig) {
+		c.interval = d
+	}
+}
+
+// WithQuiet stops NewSafeMap from printing the shard count to stdout.
+// example usage: m := ez.NewSafeMap(16, ez.WithQuiet())
+func WithQuiet() SafeMapOption {
+	return func(c *safeMapConfig) {
+		c.quiet = true
+	}
+}
+
+// WithClock replaces time.Now for TTL bookkeeping, handy for tests with a fake clock.
+// The janitor still ticks on real time.
+// example usage: m := ez.NewSafeMap(16, ez.WithClock(fake.Now))
+func WithClock(now func() time.Time) SafeMapOption {
+	return func(c *safeMapConfig) {
+		c.clock = now
+	}
+}
+
+// WithReplaceEvictions makes OnEvict hooks also run with ReasonReplaced when an insert
+// or update overwrites a value, so resources held by the old value can be released.
+// example usage: m := ez.NewSafeMap(16, ez.WithReplaceEvictions())
+func WithReplaceEvictions() SafeMapOption {
+	return func(c *safeMapConfig) {
+		c.replaced = true
+	}
+}
+
+// WithOrderedIndex keeps a sorted index of the keys next to the shards
+// so ScanPrefix and Range walk keys in order instead of sorting the whole map.
+// example usage: m := ez.NewSafeMap(16, ez.WithOrderedIndex())
+func WithOrderedIndex() SafeMapOption {
+	return func(c *safeMapConfig) {
+		c.ordered = true
+	}
+}
+
+// WithMaxBytes bounds the SafeMap to roughly n bytes of keys and values.
+// Values implementing Sizer report their own size, everything else is estimated with reflection.
+// Entries are evicted with the policy from WithMaxEntries, or LRU when none is set.
+// The budget is split over the shards, a single value bigger than its shard's share is refused
+// and the key it was written to is evicted with ReasonCapacity.
+// example usage: m := ez.NewSafeMap(16, ez.WithMaxBytes(64<<20))
+func WithMaxBytes(n int64) SafeMapOption {
+	return func(c *safeMapConfig) {
+		c.maxBytes = n
+	}
+}
+
+// WithSizer replaces the size estimate used by WithMaxBytes.
+// example usage: m := ez.NewSafeMap(16, ez.WithMaxBytes(64<<20), ez.WithSizer(func(key, value any) int64 { return int64(len(value.([]byte))) }))
+func WithSizer(fn func(key, value any) int64) SafeMapOption {
+	return func(c *safeMapConfig) {
+		c.sizer = fn
+	}
 }
 
 func copyString(s string) string {
@@ -1573,36 +1385,99 @@ func copyString(s string) string {
 	return *(*string)(unsafe.Pointer(&b))
 }
 
-func NewSafeMap(size int) *SafeMap {
-	m := &SafeMap{
-		shards: make([]*sync.Map, size),
+// NewSafeMap creates a string keyed SafeMap with the given number of shards.
+// example usage: m := ez.NewSafeMap(16)
+func NewSafeMap(size int, opts ...SafeMapOption) *SafeMap {
+	return NewSafeMapOf[string, interface{}](size, opts...)
+}
+
+// NewSafeMapOf creates a typed SafeMapOf with the given number of shards.
+// The janitor goroutine runs until Close is called.
+// example usage: m := ez.NewSafeMapOf[string, []byte](16)
+func NewSafeMapOf[K comparable, V any](size int, opts ...SafeMapOption) *SafeMapOf[K, V] {
+	if size < 1 {
+		size = 1
+	}
+	cfg := safeMapConfig{interval: 30 * time.Second, clock: time.Now}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	m := &SafeMapOf[K, V]{
+		shards:   make([]*shard[K, V], size),
+		now:      cfg.clock,
+		replaced: cfg.replaced,
+	}
+	if cfg.ordered {
+		m.index = newSkipList[K]()
+	}
+	if cfg.maxBytes > 0 {
+		m.sizer = cfg.sizer
+		if m.sizer == nil {
+			m.sizer = estimateEntrySize
+		}
 	}
 
-	fmt.Println(len(m.shards), "shards created for SafeMap with approximate size:", size)
+	if !cfg.quiet {
+		fmt.Println(len(m.shards), "shards created for SafeMap with approximate size:", size)
+	}
+	perShard := 0
+	if cfg.maxEntries > 0 {
+		perShard = (cfg.maxEntries + size - 1) / size
+	}
+	perShardBytes := int64(0)
+	if cfg.maxBytes > 0 {
+		perShardBytes = (cfg.maxBytes + int64(size) - 1) / int64(size)
+	}
 	for i := range m.shards {
-		m.shards[i] = &sync.Map{}
+		m.shards[i] = &shard[K, V]{
+			items:    make(map[K]*entry[V]),
+			max:      perShard,
+			maxBytes: perShardBytes,
+			policy:   newEvictor[K](cfg.policy, perShard, perShardBytes > 0),
+		}
+		if cfg.hotKeys > 0 {
+			m.shards[i].hot = newHotTracker[K](cfg.hotKeys)
+		}
 	}
 
-	runJanitor(m, 30*time.Second)
-	runtime.SetFinalizer(m, stopJanitor)
+	if cfg.interval > 0 {
+		runJanitor(m, cfg.interval)
+	}
 	return m
 }
 
-func runJanitor(m *SafeMap, ci time.Duration) {
+// Close stops the janitor goroutine and flushes and closes the write-ahead log if one is open.
+// It is safe to call more than once. The map stays usable afterwards,
+// but expired entries are no longer swept and writes are no longer logged.
+// example usage: defer m.Close()
+func (m *SafeMapOf[K, V]) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		if m.janitor != nil {
+			close(m.janitor.stop)
+		}
+		if m.wal != nil {
+			err = m.wal.close()
+		}
+	})
+	return err
+}
+
+func runJanitor[K comparable, V any](m *SafeMapOf[K, V], ci time.Duration) {
 	j := &janitor{
 		interval: ci,
-		stop:     make(chan bool),
+		stop:     make(chan struct{}),
 	}
 	m.janitor = j
-	go j.Run(m)
+	go j.Run(m.CleanExpired)
 }
 
-func (j *janitor) Run(m *SafeMap) {
+func (j *janitor) Run(clean func()) {
 	ticker := time.NewTicker(j.interval)
 	for {
 		select {
 		case <-ticker.C:
-			m.CleanExpired()
+			clean()
 		case <-j.stop:
 			ticker.Stop()
 			return
@@ -1610,93 +1485,806 @@ func (j *janitor) Run(m *SafeMap) {
 	}
 }
 
-func stopJanitor(m *SafeMap) {
-	m.janitor.stop <- true
+// hashKey hashes any comparable key for shard selection.
+// strings and integers are hashed directly, everything else like a map key with maphash.
+func hashKey[K comparable](key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		h := fnv.New64a()
+		h.Write([]byte(k))
+		return h.Sum64()
+	case int:
+		return mixHash(uint64(k))
+	case int64:
+		return mixHash(uint64(k))
+	case int32:
+		return mixHash(uint64(k))
+	case uint:
+		return mixHash(uint64(k))
+	case uint64:
+		return mixHash(k)
+	case uint32:
+		return mixHash(uint64(k))
+	case float64:
+		// -0 == +0, so both must land on the same shard
+		if k == 0 {
+			k = 0
+		}
+		return mixHash(math.Float64bits(k))
+	case float32:
+		if k == 0 {
+			k = 0
+		}
+		return mixHash(uint64(math.Float32bits(k)))
+	default:
+		// hashes like a map key: pointers by address, floats with -0 == +0
+		return maphash.Comparable(hashSeed, key)
+	}
+}
+
+// hashSeed seeds hashKey for key types without a fast path.
+var hashSeed = maphash.MakeSeed()
+
+// mixHash spreads integer keys over the shards (splitmix64 finalizer).
+func mixHash(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (m *SafeMapOf[K, V]) getShardIndex(key K) int {
+	return int(hashKey(key) % uint64(len(m.shards)))
 }
 
-func (m *SafeMap) getShardIndex(key string) int {
-	h := fnv.New64a()
-	h.Write([]byte(key))
-	return int(h.Sum64() % uint64(len(m.shards)))
+// copyKey and copyValue detach string data from the caller's memory.
+func copyKey[K comparable](key K) K {
+	if s, ok := any(key).(string); ok {
+		return any(copyString(s)).(K)
+	}
+	return key
 }
 
+func copyValue[V any](value V) V {
+	if s, ok := any(value).(string); ok {
+		if v, ok := any(copyString(s)).(V); ok {
+			return v
+		}
+	}
+	return value
+}
 
 // Insert adds a key-value pair to the SafeMap with a specified access counter.
 // The value will be removed after the counter reaches zero.
 // This method does not set an expiration time.
 // example usage: m.Insert("mykey", 3, "myvalue")
-func (m *SafeMap) Insert(key string, counter uint32, value interface{}) {
-	m.InsertWithTTL(key, 0, counter, value)
+func (m *SafeMapOf[K, V]) Insert(key K, counter uint32, value V, tags ...string) {
+	m.InsertWithTTL(key, 0, counter, value, tags...)
 }
 
-
 // InsertWithTTL adds a key-value pair to the SafeMap with a specified access counter and time-to-live (TTL).
 // The value will expire after the given TTL or after the counter reaches zero, whichever comes first.
+// On a bounded map a full shard evicts one entry first, with TinyLFU the new key may be rejected instead.
+// A value larger than the byte budget of its shard is not stored and any older value under key is evicted.
+// Optional tags group entries so InvalidateTag can drop them together.
 // example usage: m.InsertWithTTL("mykey", 10*time.Second, 3, "myvalue")
-func (m *SafeMap) InsertWithTTL(key string, ttl time.Duration, counter uint32, value interface{}) {
-		key = copyString(key)
-		if s, ok := value.(string); ok {
-			value = copyString(s)
+//
+// example usage: m.InsertWithTTL("profile:42", time.Minute, 0, profile, "user:42", "tenant:acme")
+func (m *SafeMapOf[K, V]) InsertWithTTL(key K, ttl time.Duration, counter uint32, value V, tags ...string) {
+	key = copyKey(key)
+	e := m.newEntry(copyValue(value), ttl, counter)
+	e.tags = copyTags(tags)
+
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	if s.hot != nil {
+		s.hot.record(key)
+	}
+	evs, stored := m.insertLocked(s, key, e)
+	m.publishAll(evs)
+	if stored {
+		m.publish(EventSet, key, e.value)
+	}
+	s.mu.Unlock()
+	m.notifyAll(evs)
+}
+
+func (m *SafeMapOf[K, V]) newEntry(value V, ttl time.Duration, counter uint32) *entry[V] {
+	expire := time.Time{}
+	if ttl > 0 {
+		expire = m.now().Add(ttl)
+	}
+	e := &entry[V]{value: value, expire: expire, getcounter: atomic.Uint32{}}
+	e.getcounter.Store(counter)
+	return e
+}
+
+func (e *entry[V]) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// insertLocked stores e under key, the shard lock must be held.
+// It returns the entries it pushed out so hooks can run after unlocking,
+// and false when a TinyLFU shard refused the new key or e alone is over the byte budget.
+func (m *SafeMapOf[K, V]) insertLocked(s *shard[K, V], key K, e *entry[V]) ([]eviction[K, V], bool) {
+	frame, err := m.prepareLocked(s, key, e)
+	if errors.Is(err, errOverBudget) {
+		// the key cannot hold the new value, so the old one must not stay readable either
+		if old := m.removeLocked(s, key); old != nil {
+			return []eviction[K, V]{{key, old.value, ReasonCapacity}}, false
 		}
-       idx := m.getShardIndex(key)
-       expire := time.Time{}
-       if ttl > 0 {
-	       expire = time.Now().Add(ttl)
-       }
-       e := &entry{value: value, expire: expire, getcounter: atomic.Uint32{}}
-       e.getcounter.Store(counter)
+		return nil, false
+	}
+	if err != nil {
+		// the log cannot hold the write, so it is refused and the old value stays
+		return nil, false
+	}
+	return m.storeLocked(s, key, e, frame, true)
+}
 
-       if _, exists := m.shards[idx].Load(key); !exists {
-	       m.size.Add(1)
-       }
+var errOverBudget = errors.New("value is over the shard byte budget")
 
-       m.shards[idx].Store(key, e)
+// prepareLocked sizes e and encodes its log record, the shard lock must be held.
+// An error means the write has to be refused.
+func (m *SafeMapOf[K, V]) prepareLocked(s *shard[K, V], key K, e *entry[V]) ([]byte, error) {
+	frame, err := m.walFrame(walOpSet, key, e)
+	if err != nil {
+		return nil, err
+	}
+	if s.maxBytes > 0 {
+		e.size = m.sizer(key, e.value)
+		if e.size > s.maxBytes {
+			return nil, fmt.Errorf("failed to store key %v: %w: %d of %d bytes", key, errOverBudget, e.size, s.maxBytes)
+		}
+	}
+	return frame, nil
+}
+
+// storeLocked writes a prepared e under key, the shard lock must be held.
+// With filter a TinyLFU shard may refuse a new key, otherwise it is always admitted.
+func (m *SafeMapOf[K, V]) storeLocked(s *shard[K, V], key K, e *entry[V], frame []byte, filter bool) ([]eviction[K, V], bool) {
+	if old, exists := s.items[key]; exists {
+		s.items[key] = e
+		m.addBytes(s, e.size-old.size)
+		s.unschedule(old)
+		s.schedule(key, e)
+		m.logFrame(s, frame)
+		m.untag(key, old.tags)
+		m.tag(key, e.tags)
+		m.stats.inserts.Add(1)
+		if s.policy != nil {
+			s.policy.access(key)
+		}
+		reason := ReasonReplaced
+		if old.expired(m.now()) {
+			reason = ReasonExpired
+		}
+		return m.shrinkLocked(s, key, []eviction[K, V]{{key, old.value, reason}}), true
+	}
+
+	var evs []eviction[K, V]
+	admitted := !filter
+	full := func() bool {
+		return (s.max > 0 && len(s.items) >= s.max) || (s.maxBytes > 0 && s.bytes+e.size > s.maxBytes)
+	}
+	for s.policy != nil && full() {
+		vk, ok := s.policy.victim()
+		if !ok {
+			break
+		}
+		if !admitted {
+			if !s.policy.admit(key, vk) {
+				return evs, false
+			}
+			admitted = true
+		}
+		victim := m.removeLocked(s, vk)
+		evs = append(evs, eviction[K, V]{vk, victim.value, ReasonCapacity})
+	}
+	s.items[key] = e
+	m.addBytes(s, e.size)
+	s.schedule(key, e)
+	m.logFrame(s, frame)
+	m.tag(key, e.tags)
+	if m.index != nil {
+		m.index.insert(keyText(key), key)
+	}
+	if s.policy != nil {
+		s.policy.add(key)
+	}
+	m.size.Add(1)
+	m.stats.inserts.Add(1)
+	return evs, true
 }
 
+// removeLocked drops key from the shard and returns its entry, the shard lock must be held.
+func (m *SafeMapOf[K, V]) removeLocked(s *shard[K, V], key K) *entry[V] {
+	e, exists := s.items[key]
+	if !exists {
+		return nil
+	}
+	delete(s.items, key)
+	s.unschedule(e)
+	m.addBytes(s, -e.size)
+	m.logDelete(s, key)
+	m.untag(key, e.tags)
+	if m.index != nil {
+		m.index.remove(keyText(key), key)
+	}
+	if s.policy != nil {
+		s.policy.remove(key)
+	}
+	m.size.Add(^uint32(0))
+	return e
+}
 
 // Get retrieves the value associated with the given key from the SafeMap.
-// If the access counter reaches zero, the key is deleted and (nil, false) is returned.
-// Returns the value and true if found, otherwise (nil, false).
+// If the access counter reaches zero, the key is deleted and (zero, false) is returned.
+// An entry past its TTL is removed and reported as missing even before the janitor runs.
+// Returns the value and true if found, otherwise (zero, false).
 // example usage: val, ok := m.Get("mykey")
-func (m *SafeMap) Get(key string) (interface{}, bool) {
-       idx := m.getShardIndex(key)
-       value, exists := m.shards[idx].Load(key)
-       if !exists {
-	       return nil, false
-       }
+func (m *SafeMapOf[K, V]) Get(key K) (V, bool) {
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	value, ok, evs := m.getLocked(s, key, m.now())
+	m.publishAll(evs)
+	s.mu.Unlock()
+	if ok {
+		m.stats.hits.Add(1)
+	} else {
+		m.stats.misses.Add(1)
+	}
+	m.notifyAll(evs)
+	return value, ok
+}
 
-       e := value.(*entry)
-       if e.getcounter.Load() == 1 {
-	       m.shards[idx].Delete(key)
-	       m.size.Add(^uint32(0))
-	       return nil, false
-       } else if e.getcounter.Load() > 1 {
-	       e.getcounter.Add(^uint32(0))
-       }
+// getLocked does the Get bookkeeping with the shard lock held, the returned
+// evictions must be passed to publishAll before and notifyAll after unlocking.
+func (m *SafeMapOf[K, V]) getLocked(s *shard[K, V], key K, now time.Time) (V, bool, []eviction[K, V]) {
+	var zero V
+	if s.hot != nil {
+		s.hot.record(key)
+	}
+	e, exists := s.items[key]
+	if !exists {
+		return zero, false, nil
+	}
+	if e.expired(now) {
+		m.removeLocked(s, key)
+		return zero, false, []eviction[K, V]{{key, e.value, ReasonExpired}}
+	}
 
-       return e.value, true
+	if e.getcounter.Load() == 1 {
+		m.removeLocked(s, key)
+		return zero, false, []eviction[K, V]{{key, e.value, ReasonExhausted}}
+	} else if e.getcounter.Load() > 1 {
+		e.getcounter.Add(^uint32(0))
+	}
+	if e.sliding > 0 {
+		e.expire = now.Add(e.sliding)
+	}
+	if s.policy != nil {
+		s.policy.access(key)
+	}
+	return e.value, true, nil
 }
 
-
 // Delete removes the key and its value from the SafeMap if it exists.
 // example usage: m.Delete("mykey")
-func (m *SafeMap) Delete(key string) {
-	idx := m.getShardIndex(key)
-	if _, exists := m.shards[idx].LoadAndDelete(key); exists {
-		m.size.Add(^uint32(0)) 
+func (m *SafeMapOf[K, V]) Delete(key K) {
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	e := m.removeLocked(s, key)
+	if e != nil {
+		m.publishEviction(key, e.value, ReasonDeleted)
+	}
+	s.mu.Unlock()
+	if e != nil {
+		m.notifyEvict(key, e.value, ReasonDeleted)
+	}
+}
+
+// CleanExpired removes every entry whose TTL has run out.
+// Each shard keeps its deadlines in a heap so only due entries are visited.
+// The janitor calls this on its interval, Get also treats expired entries as missing.
+// example usage: m.CleanExpired()
+func (m *SafeMapOf[K, V]) CleanExpired() {
+	now := m.now()
+	for _, s := range m.shards {
+		var expired []keyValue[K, V]
+		s.mu.Lock()
+		for len(s.expiries) > 0 && !s.expiries[0].at.After(now) {
+			item := heap.Pop(&s.expiries).(*expiryItem[K, V])
+			e := item.e
+			if e.expired(now) {
+				m.removeLocked(s, item.key)
+				m.publishEviction(item.key, e.value, ReasonExpired)
+				expired = append(expired, keyValue[K, V]{key: item.key, value: e.value})
+				continue
+			}
+			// a sliding entry or Touch moved the deadline back
+			s.schedule(item.key, e)
+		}
+		s.mu.Unlock()
+		for _, ev := range expired {
+			m.notifyEvict(ev.key, ev.value, ReasonExpired)
+		}
+	}
+}
+
+// EvictReason tells an OnEvict hook why an entry left the SafeMap
+type EvictReason int
+
+const (
+	// ReasonDeleted means Delete was called for the key
+	ReasonDeleted EvictReason = iota
+	// ReasonExpired means the TTL ran out and CleanExpired removed the entry
+	ReasonExpired
+	// ReasonExhausted means the access counter reached zero in Get
+	ReasonExhausted
+	// ReasonCapacity means a bounded map evicted the entry to make room
+	ReasonCapacity
+	// ReasonReplaced means an insert overwrote the value stored under the key,
+	// it is only reported with WithReplaceEvictions
+	ReasonReplaced
+	// ReasonCleared means Clear emptied the map
+	ReasonCleared
+	// ReasonInvalidated means InvalidateTag dropped the entry
+	ReasonInvalidated
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case ReasonDeleted:
+		return "deleted"
+	case ReasonExpired:
+		return "expired"
+	case ReasonExhausted:
+		return "exhausted"
+	case ReasonCapacity:
+		return "capacity"
+	case ReasonReplaced:
+		return "replaced"
+	case ReasonCleared:
+		return "cleared"
+	case ReasonInvalidated:
+		return "invalidated"
+	default:
+		return "unknown"
+	}
+}
+
+type keyValue[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// OnEvict registers a hook that runs every time an entry leaves the SafeMap.
+// Overwritten values are only reported when the map was created with WithReplaceEvictions.
+// Hooks run after the shard lock is released so they may call back into the map.
+// example usage: m.OnEvict(func(key string, value any, reason ez.EvictReason) { fmt.Println(key, reason) })
+func (m *SafeMapOf[K, V]) OnEvict(fn func(key K, value V, reason EvictReason)) {
+	m.mu.Lock()
+	m.onEvict = append(m.onEvict, fn)
+	m.mu.Unlock()
+}
+
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
+
+// publishAll sends the events of evs to subscribers. It runs before the shard lock is
+// released so the events of one key reach subscribers in the order the changes happened.
+func (m *SafeMapOf[K, V]) publishAll(evs []eviction[K, V]) {
+	for _, ev := range evs {
+		m.publishEviction(ev.key, ev.value, ev.reason)
 	}
 }
 
-func (m *SafeMap) CleanExpired() {
-	now := time.Now()
-	for i := 0; i < len(m.shards); i++ {
-		m.shards[i].Range(func(key, value interface{}) bool {
-			e := value.(*entry)
-			if !e.expire.IsZero() && now.After(e.expire) {
-				m.shards[i].Delete(key)
-				m.size.Add(^uint32(0)) 
+// notifyAll and notifyEvict count evictions and run the OnEvict hooks, they run after
+// unlocking so a hook may use the map. Events are sent earlier by publishAll.
+func (m *SafeMapOf[K, V]) notifyAll(evs []eviction[K, V]) {
+	for _, ev := range evs {
+		m.notifyEvict(ev.key, ev.value, ev.reason)
+	}
+}
+
+func (m *SafeMapOf[K, V]) notifyEvict(key K, value V, reason EvictReason) {
+	m.stats.record(reason)
+	if reason == ReasonReplaced && !m.replaced {
+		return
+	}
+	m.mu.RLock()
+	hooks := m.onEvict
+	m.mu.RUnlock()
+	for _, fn := range hooks {
+		fn(key, value, reason)
+	}
+}
+
+// Len returns the number of entries in the SafeMap.
+// Entries past their TTL count until CleanExpired removes them.
+// example usage: n := m.Len()
+func (m *SafeMapOf[K, V]) Len() int {
+	return int(m.size.Load())
+}
+
+// All iterates over every live entry, shard by shard.
+// Expired entries are skipped and access counters are not touched.
+// Each shard is copied before yielding so the loop body may use the map.
+// example usage: for key, value := range m.All() { fmt.Println(key, value) }
+func (m *SafeMapOf[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, s := range m.shards {
+			for _, ev := range m.liveEntries(s) {
+				if !yield(ev.key, ev.value) {
+					return
+				}
 			}
-			return true 
-		})
+		}
+	}
+}
+
+// Keys iterates over the keys of every live entry.
+// example usage: for key := range m.Keys() { fmt.Println(key) }
+func (m *SafeMapOf[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range m.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+func (m *SafeMapOf[K, V]) liveEntries(s *shard[K, V]) []keyValue[K, V] {
+	now := m.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]keyValue[K, V], 0, len(s.items))
+	for key, e := range s.items {
+		if !e.expire.IsZero() && now.After(e.expire) {
+			continue
+		}
+		out = append(out, keyValue[K, V]{key: key, value: e.value})
+	}
+	return out
+}
+
+// Clear removes every entry from the SafeMap.
+// example usage: m.Clear()
+func (m *SafeMapOf[K, V]) Clear() {
+	for _, s := range m.shards {
+		s.mu.Lock()
+		removed := make([]keyValue[K, V], 0, len(s.items))
+		for key, e := range s.items {
+			m.removeLocked(s, key)
+			m.publishEviction(key, e.value, ReasonCleared)
+			removed = append(removed, keyValue[K, V]{key: key, value: e.value})
+		}
+		s.mu.Unlock()
+		for _, ev := range removed {
+			m.notifyEvict(ev.key, ev.value, ReasonCleared)
+		}
+	}
+}
+
+// GetOrInsert returns the live value stored under key, or inserts value when there is none.
+// loaded reports whether the value was already there. The access counter is not used up.
+// example usage: val, loaded := m.GetOrInsert("mykey", time.Minute, 0, "myvalue")
+func (m *SafeMapOf[K, V]) GetOrInsert(key K, ttl time.Duration, counter uint32, value V) (actual V, loaded bool) {
+	key = copyKey(key)
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	if e, ok := s.items[key]; ok && !e.expired(m.now()) {
+		s.mu.Unlock()
+		return e.value, true
+	}
+	value = copyValue(value)
+	evs, stored := m.insertLocked(s, key, m.newEntry(value, ttl, counter))
+	m.publishAll(evs)
+	if stored {
+		m.publish(EventSet, key, value)
+	}
+	s.mu.Unlock()
+	m.notifyAll(evs)
+	return value, false
+}
+
+// CompareAndSwap stores new under key if the current value equals old.
+// The TTL and access counter of the entry are kept.
+// Like sync.Map it panics when the stored value is not comparable.
+// example usage: swapped := m.CompareAndSwap("mykey", "old", "new")
+func (m *SafeMapOf[K, V]) CompareAndSwap(key K, old, new V) bool {
+	swapped := false
+	m.compute(key, func(cur V, ok bool) (V, updateOp) {
+		if !ok || any(cur) != any(old) {
+			return cur, opNone
+		}
+		swapped = true
+		return copyValue(new), opStore
+	})
+	return swapped
+}
+
+// CompareAndDelete deletes key if its current value equals old.
+// Like sync.Map it panics when the stored value is not comparable.
+// example usage: deleted := m.CompareAndDelete("mykey", "old")
+func (m *SafeMapOf[K, V]) CompareAndDelete(key K, old V) bool {
+	deleted := false
+	m.compute(key, func(cur V, ok bool) (V, updateOp) {
+		if !ok || any(cur) != any(old) {
+			return cur, opNone
+		}
+		deleted = true
+		return cur, opDelete
+	})
+	return deleted
+}
+
+// Update atomically replaces the value under key with the result of fn.
+// fn gets the current value and whether it exists, returning false from fn deletes the key.
+// Existing entries keep their TTL and access counter, new ones never expire.
+// fn runs with the shard locked so it must not call back into the map.
+// example usage: m.Update("hits", func(old any, ok bool) (any, bool) { if !ok { return 1, true }; return old.(int) + 1, true })
+func (m *SafeMapOf[K, V]) Update(key K, fn func(old V, ok bool) (V, bool)) (V, bool) {
+	return m.compute(key, func(cur V, ok bool) (V, updateOp) {
+		next, keep := fn(cur, ok)
+		if !keep {
+			return next, opDelete
+		}
+		return copyValue(next), opStore
+	})
+}
+
+// Increment atomically adds delta to the number stored under key and returns the result.
+// A missing key starts from zero, int64 is used when the value type is interface{}.
+// The TTL and access counter of the entry are kept.
+// example usage: n, err := m.Increment("visits", 1)
+func (m *SafeMapOf[K, V]) Increment(key K, delta int64) (V, error) {
+	var err error
+	v, _ := m.compute(key, func(cur V, ok bool) (V, updateOp) {
+		next, addErr := addNumber(cur, ok, delta)
+		if addErr != nil {
+			err = fmt.Errorf("value for key %v: %w", key, addErr)
+			return cur, opNone
+		}
+		return next, opStore
+	})
+	return v, err
+}
+
+// Decrement atomically subtracts delta from the number stored under key.
+// example usage: n, err := m.Decrement("slots", 1)
+func (m *SafeMapOf[K, V]) Decrement(key K, delta int64) (V, error) {
+	return m.Increment(key, -delta)
+}
+
+type updateOp int
+
+const (
+	opNone updateOp = iota
+	opStore
+	opDelete
+)
+
+// compute is the shared read-modify-write behind the atomic helpers.
+// It returns the value left under key and whether the key is present afterwards.
+func (m *SafeMapOf[K, V]) compute(key K, fn func(cur V, ok bool) (V, updateOp)) (V, bool) {
+	var zero V
+	key = copyKey(key)
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	e, exists := s.items[key]
+	live := exists && !e.expired(m.now())
+	var cur V
+	if live {
+		cur = e.value
+	}
+
+	next, op := fn(cur, live)
+	var evs []eviction[K, V]
+	present := live
+	switch op {
+	case opNone:
+		next = cur
+	case opDelete:
+		if exists {
+			m.removeLocked(s, key)
+			reason := ReasonDeleted
+			if !live {
+				reason = ReasonExpired
+			}
+			evs = append(evs, eviction[K, V]{key, e.value, reason})
+		}
+		next, present = zero, false
+	case opStore:
+		if live {
+			ne := &entry[V]{value: next, expire: e.expire, sliding: e.sliding, tags: e.tags}
+			ne.getcounter.Store(e.getcounter.Load())
+			if s.maxBytes > 0 {
+				ne.size = m.sizer(key, next)
+			}
+			if s.maxBytes > 0 && ne.size > s.maxBytes {
+				// same as insertLocked, an over budget value drops the key
+				m.removeLocked(s, key)
+				evs = append(evs, eviction[K, V]{key, e.value, ReasonCapacity})
+				next, present = zero, false
+				break
+			}
+			frame, err := m.walFrame(walOpSet, key, ne)
+			if err != nil {
+				// refused like insertLocked, the key keeps its value
+				next, op = cur, opNone
+				break
+			}
+			s.items[key] = ne
+			s.unschedule(e)
+			s.schedule(key, ne)
+			m.addBytes(s, ne.size-e.size)
+			m.logFrame(s, frame)
+			if s.policy != nil {
+				s.policy.access(key)
+			}
+			evs = m.shrinkLocked(s, key, []eviction[K, V]{{key, e.value, ReasonReplaced}})
+			present = true
+		} else {
+			evs, present = m.insertLocked(s, key, m.newEntry(next, 0, 0))
+		}
+	}
+	m.publishAll(evs)
+	if op == opStore && present {
+		m.publish(EventSet, key, next)
 	}
-}
\ No newline at end of file
+	s.mu.Unlock()
+	m.notifyAll(evs)
+	return next, present
+}
+
+// addNumber adds delta to a numeric value, missing values count as zero.
+func addNumber[V any](cur V, ok bool, delta int64) (V, error) {
+	if !ok {
+		var zero V
+		if any(zero) == nil {
+			// an interface V starts from int64, unless int64 does not satisfy it
+			if v, ok := any(delta).(V); ok {
+				return v, nil
+			}
+			return zero, fmt.Errorf("int64 does not implement value type %s", reflect.TypeOf(&zero).Elem())
+		}
+		cur = zero
+	}
+	var out any
+	switch n := any(cur).(type) {
+	case int:
+		out = n + int(delta)
+	case int8:
+		out = n + int8(delta)
+	case int16:
+		out = n + int16(delta)
+	case int32:
+		out = n + int32(delta)
+	case int64:
+		out = n + delta
+	case uint:
+		out = n + uint(delta)
+	case uint8:
+		out = n + uint8(delta)
+	case uint16:
+		out = n + uint16(delta)
+	case uint32:
+		out = n + uint32(delta)
+	case uint64:
+		out = n + uint64(delta)
+	case float32:
+		out = n + float32(delta)
+	case float64:
+		out = n + float64(delta)
+	default:
+		return cur, fmt.Errorf("%T is not a number", cur)
+	}
+	v, ok := out.(V)
+	if !ok {
+		return cur, fmt.Errorf("%T result does not fit the value type", out)
+	}
+	return v, nil
+}
+
+// NoTTL is returned by TTL for keys that never expire
+const NoTTL time.Duration = -1
+
+// InsertSliding adds a key-value pair whose expiry moves ttl into the future on every Get.
+// Handy for sessions that should live as long as they are used.
+// example usage: m.InsertSliding("session:abc", 30*time.Minute, 0, session)
+func (m *SafeMapOf[K, V]) InsertSliding(key K, ttl time.Duration, counter uint32, value V, tags ...string) {
+	key = copyKey(key)
+	e := m.newEntry(copyValue(value), ttl, counter)
+	e.tags = copyTags(tags)
+	if ttl > 0 {
+		e.sliding = ttl
+	}
+	m.insertEntry(key, e)
+}
+
+// insertEntry stores a prepared entry and sends its events and hooks.
+func (m *SafeMapOf[K, V]) insertEntry(key K, e *entry[V]) {
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	evs, stored := m.insertLocked(s, key, e)
+	m.publishAll(evs)
+	if stored {
+		m.publish(EventSet, key, e.value)
+	}
+	s.mu.Unlock()
+	m.notifyAll(evs)
+}
+
+// Peek returns the value for key without using up the access counter,
+// sliding the expiry or counting a hit. Expired entries are reported as missing.
+// example usage: val, ok := m.Peek("mykey")
+func (m *SafeMapOf[K, V]) Peek(key K) (V, bool) {
+	var zero V
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.items[key]
+	if !exists || e.expired(m.now()) {
+		return zero, false
+	}
+	return e.value, true
+}
+
+// TTL returns how long key has left to live.
+// Keys without an expiry return NoTTL, missing or expired keys return false.
+// example usage: left, ok := m.TTL("mykey")
+func (m *SafeMapOf[K, V]) TTL(key K) (time.Duration, bool) {
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.items[key]
+	now := m.now()
+	if !exists || e.expired(now) {
+		return 0, false
+	}
+	if e.expire.IsZero() {
+		return NoTTL, true
+	}
+	return e.expire.Sub(now), true
+}
+
+// Touch gives key a new expiry ttl from now, keeping its value and access counter.
+// A sliding entry keeps sliding with ttl as its new window, ttl <= 0 behaves like Persist.
+// Returns false if the key is missing or already expired.
+// example usage: ok := m.Touch("mykey", time.Minute)
+func (m *SafeMapOf[K, V]) Touch(key K, ttl time.Duration) bool {
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.items[key]
+	now := m.now()
+	if !exists || e.expired(now) {
+		return false
+	}
+	if ttl <= 0 {
+		e.expire, e.sliding = time.Time{}, 0
+	} else {
+		e.expire = now.Add(ttl)
+		if e.sliding > 0 {
+			e.sliding = ttl
+		}
+	}
+	s.schedule(key, e)
+	m.logSet(s, key, e)
+	return true
+}
+
+// Persist removes the expiry from key so only Delete or the access counter remove it.
+// Returns false if the key is missing or already expired.
+// example usage: ok := m.Persist("mykey")
+func (m *SafeMapOf[K, V]) Persist(key K) bool {
+	return m.Touch(key, 0)
+}
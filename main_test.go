@@ -0,0 +1,145 @@
+package ez
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncrementInterfaceValueType(t *testing.T) {
+	m := NewSafeMapOf[string, fmt.Stringer](1, WithQuiet())
+	defer m.Close()
+	if _, err := m.Increment("n", 1); err == nil {
+		t.Fatal("Increment on a fmt.Stringer map returned no error")
+	}
+	if _, ok := m.Get("n"); ok {
+		t.Fatal("failed Increment stored a value")
+	}
+
+	im := NewSafeMap(1, WithQuiet())
+	defer im.Close()
+	if v, err := im.Increment("n", 2); err != nil || v != int64(2) {
+		t.Fatalf("Increment = %v, %v, want 2, nil", v, err)
+	}
+}
+
+func TestOnEvictReplacedIsOptIn(t *testing.T) {
+	for _, opt := range []bool{false, true} {
+		opts := []SafeMapOption{WithQuiet()}
+		if opt {
+			opts = append(opts, WithReplaceEvictions())
+		}
+		m := NewSafeMap(1, opts...)
+		var reasons []EvictReason
+		m.OnEvict(func(key string, value any, reason EvictReason) {
+			reasons = append(reasons, reason)
+		})
+		m.Insert("k", 0, 1)
+		m.Insert("k", 0, 2)
+		m.Delete("k")
+		m.Close()
+
+		want := []EvictReason{ReasonDeleted}
+		if opt {
+			want = []EvictReason{ReasonReplaced, ReasonDeleted}
+		}
+		if fmt.Sprint(reasons) != fmt.Sprint(want) {
+			t.Errorf("WithReplaceEvictions=%v: reasons %v, want %v", opt, reasons, want)
+		}
+	}
+}
+
+func TestPointerKeysHashByAddress(t *testing.T) {
+	type node struct{ n int }
+	m := NewSafeMapOf[*node, int](16, WithQuiet())
+	defer m.Close()
+	keys := make([]*node, 50)
+	for i := range keys {
+		keys[i] = &node{}
+		m.Insert(keys[i], 0, i)
+	}
+	for i, k := range keys {
+		k.n = i + 1
+		if v, ok := m.Get(k); !ok || v != i {
+			t.Fatalf("Get(key %d) after mutation = %v, %v, want %d, true", i, v, ok, i)
+		}
+		m.Delete(k)
+	}
+	if n := m.Len(); n != 0 {
+		t.Fatalf("Len() = %d after deleting every key, want 0", n)
+	}
+}
+
+func TestFloatKeysNegativeZero(t *testing.T) {
+	m := NewSafeMapOf[float64, string](16, WithQuiet())
+	defer m.Close()
+	m.Insert(0.0, 0, "zero")
+	if v, ok := m.Get(math.Copysign(0, -1)); !ok || v != "zero" {
+		t.Fatalf("Get(-0) = %q, %v, want zero, true", v, ok)
+	}
+
+	a := NewSafeMapOf[any, string](16, WithQuiet())
+	defer a.Close()
+	a.Insert(float32(0), 0, "zero")
+	if _, ok := a.Get(float32(math.Copysign(0, -1))); !ok {
+		t.Fatal("Get(float32 -0) missed the +0 entry")
+	}
+}
+
+func TestIterationSkipsExpiredAndKeepsCounters(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := NewSafeMapOf[string, int](4, WithClock(clock.Now), WithJanitorInterval(0), WithQuiet())
+	defer m.Close()
+	m.Insert("a", 2, 1)
+	m.Insert("b", 0, 2)
+	m.InsertWithTTL("gone", time.Second, 0, 3)
+	clock.Add(2 * time.Second)
+
+	got := map[string]int{}
+	for key, value := range m.All() {
+		got[key] = value
+		// the loop body may write to the map it ranges over
+		m.Insert("b", 0, value)
+	}
+	if len(got) != 2 || got["a"] != 1 {
+		t.Fatalf("All() = %v, want a and b without the expired entry", got)
+	}
+	if _, ok := m.Get("a"); !ok {
+		t.Fatal("All() used up the access counter of a")
+	}
+
+	var keys []string
+	for key := range m.Keys() {
+		keys = append(keys, key)
+		break
+	}
+	if len(keys) != 1 {
+		t.Fatalf("Keys() yielded %d keys after break, want 1", len(keys))
+	}
+}
+
+func TestClearReportsEveryEntry(t *testing.T) {
+	m := NewSafeMapOf[string, int](4, WithQuiet())
+	defer m.Close()
+	var mu sync.Mutex
+	cleared := 0
+	m.OnEvict(func(key string, value int, reason EvictReason) {
+		if reason == ReasonCleared {
+			mu.Lock()
+			cleared++
+			mu.Unlock()
+		}
+	})
+	for i := 0; i < 10; i++ {
+		m.Insert(fmt.Sprint(i), 0, i)
+	}
+	m.Clear()
+	if m.Len() != 0 {
+		t.Fatalf("Len() = %d after Clear, want 0", m.Len())
+	}
+	if cleared != 10 {
+		t.Fatalf("OnEvict saw %d cleared entries, want 10", cleared)
+	}
+}
@@ -0,0 +1,517 @@
+package ez
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MemoOption configures how the Memo helpers cache a result
+type MemoOption func(*memoConfig)
+
+type memoConfig struct {
+	ttl         time.Duration
+	maxEntries  int
+	cacheErrors bool
+	ctx         context.Context
+}
+
+// WithMemoTTL sets how long a result is cached, the default is 6 seconds.
+// A d of zero or less caches results until they are evicted, the same as WithMemoNoExpiry.
+// example usage: user, err := ez.Memo1e(loadUser, id, ez.WithMemoTTL(time.Minute))
+func WithMemoTTL(d time.Duration) MemoOption {
+	return func(c *memoConfig) {
+		c.ttl = max(d, NoTTL)
+	}
+}
+
+// WithMemoNoExpiry caches results until they are evicted by WithMemoMaxEntries.
+// example usage: cfg := ez.Memo0(loadConfig, ez.WithMemoNoExpiry())
+func WithMemoNoExpiry() MemoOption {
+	return func(c *memoConfig) {
+		c.ttl = NoTTL
+	}
+}
+
+// WithMemoMaxEntries keeps at most n results for the function, dropping the least recently used.
+// Memo0..Memo7e calls with different limits for one function keep separate caches.
+// example usage: v := ez.Memo1(render, page, ez.WithMemoMaxEntries(1000))
+func WithMemoMaxEntries(n int) MemoOption {
+	return func(c *memoConfig) {
+		c.maxEntries = n
+	}
+}
+
+// WithMemoCacheErrors also caches results of the e variants whose second value is a non-nil error.
+// By default a failure is returned to its caller only so the next call tries again.
+// example usage: v, err := ez.Memo1e(fetch, url, ez.WithMemoCacheErrors(true))
+func WithMemoCacheErrors(cache bool) MemoOption {
+	return func(c *memoConfig) {
+		c.cacheErrors = cache
+	}
+}
+
+// WithMemoContext lets a Memo0..Memo7e call stop waiting for a result another caller is already computing.
+// The computation itself keeps running and is cached for later calls. The e variants return the
+// context error as second value when it is an error. The other variants cannot report the
+// cancellation and return the zero value, use an e variant or NewMemo0Ctx..NewMemo7Ctx to tell them apart.
+// NewMemo0..NewMemo7e ignore it, the functions of NewMemo0Ctx..NewMemo7Ctx take a context per call.
+// example usage: user, err := ez.Memo1e(loadUser, id, ez.WithMemoContext(r.Context()))
+func WithMemoContext(ctx context.Context) MemoOption {
+	return func(c *memoConfig) {
+		c.ctx = ctx
+	}
+}
+
+func newMemoConfig(opts []MemoOption) memoConfig {
+	cfg := memoConfig{ttl: 6 * time.Second, ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// memoCaches holds the cache of every function used with the Memo helpers, keyed by its
+// code pointer, type and entry limit. The limit is the only option fixed when a cache is made,
+// everything else is read from the options of each call.
+var memoCaches sync.Map
+
+func memoCacheFor[K comparable](fn any, cfg memoConfig) *MemoCache[K] {
+	key := fmt.Sprintf("%p|%T|%d", fn, fn, max(cfg.maxEntries, 0))
+	if mc, ok := memoCaches.Load(key); ok {
+		return mc.(*MemoCache[K])
+	}
+	mc := newMemoCache[K](cfg)
+	if actual, loaded := memoCaches.LoadOrStore(key, mc); loaded {
+		return actual.(*MemoCache[K])
+	}
+	return mc
+}
+
+// MemoArgs2..MemoArgs7 are the cache keys of memoized functions with several arguments.
+// Results are keyed on the arguments themselves, so two calls share a result only when their arguments are ==.
+// example usage: cache.Forget(ez.MemoArgs2[int, string]{userID, lang})
+type MemoArgs2[A, B comparable] struct {
+	V1 A
+	V2 B
+}
+
+type MemoArgs3[A, B, C comparable] struct {
+	V1 A
+	V2 B
+	V3 C
+}
+
+type MemoArgs4[A, B, C, D comparable] struct {
+	V1 A
+	V2 B
+	V3 C
+	V4 D
+}
+
+type MemoArgs5[A, B, C, D, E comparable] struct {
+	V1 A
+	V2 B
+	V3 C
+	V4 D
+	V5 E
+}
+
+type MemoArgs6[A, B, C, D, E, F comparable] struct {
+	V1 A
+	V2 B
+	V3 C
+	V4 D
+	V5 E
+	V6 F
+}
+
+type MemoArgs7[A, B, C, D, E, F, G comparable] struct {
+	V1 A
+	V2 B
+	V3 C
+	V4 D
+	V5 E
+	V6 F
+	V7 G
+}
+
+// MemoCache holds the results of one memoized function, keyed by K: struct{} without
+// arguments, the argument itself for one and MemoArgs2..MemoArgs7 for more.
+// NewMemo0..NewMemo7e return it next to the function so results can be dropped.
+// It runs no goroutine, expired results are dropped when they are read or swept
+// while new results are stored, so an unused MemoCache needs no cleanup.
+type MemoCache[K comparable] struct {
+	m      *SafeMapOf[K, any]
+	cfg    memoConfig
+	group  flightGroup[K, any]
+	stores atomic.Uint32
+}
+
+// memoSweepEvery is how many stored results trigger a sweep of the expired ones.
+const memoSweepEvery = 256
+
+func newMemoCache[K comparable](cfg memoConfig) *MemoCache[K] {
+	shards := 16
+	opts := []SafeMapOption{WithQuiet(), WithJanitorInterval(0)}
+	if cfg.maxEntries > 0 {
+		// the limit is split per shard, keep small limits close to exact
+		shards = min(shards, max(1, cfg.maxEntries/64))
+		opts = append(opts, WithMaxEntries(cfg.maxEntries, EvictLRU))
+	}
+	// a memoized function takes its context per call, never from the options it was made with
+	cfg.ctx = context.Background()
+	return &MemoCache[K]{m: NewSafeMapOf[K, any](shards, opts...), cfg: cfg}
+}
+
+// Forget drops the cached result for the given arguments.
+// example usage: cache.Forget(userID)
+func (c *MemoCache[K]) Forget(key K) {
+	c.m.Delete(key)
+}
+
+// Purge drops every cached result.
+// example usage: cache.Purge()
+func (c *MemoCache[K]) Purge() {
+	c.m.Clear()
+}
+
+// Len returns the number of cached results.
+// example usage: n := cache.Len()
+func (c *MemoCache[K]) Len() int {
+	return c.m.Len()
+}
+
+// store caches a result and now and then sweeps out expired ones in place of a janitor.
+func (c *MemoCache[K]) store(key K, ttl time.Duration, value any) {
+	c.m.InsertWithTTL(key, ttl, 0, value)
+	if c.stores.Add(1)%memoSweepEvery == 0 {
+		c.m.CleanExpired()
+	}
+}
+
+// memoPair holds both results of an e variant.
+type memoPair[R1, R2 any] struct {
+	v1 R1
+	v2 R2
+}
+
+func (p memoPair[R1, R2]) failed() bool {
+	err, ok := any(p.v2).(error)
+	return ok && err != nil
+}
+
+// memoDo returns the cached result for key or calls fn and caches what it returns.
+// Concurrent misses for one key share a single fn call, a caller whose ctx ends
+// first gets its error instead. A panic in fn is raised again in every caller with the same value.
+// failed may be nil, otherwise results it reports are only cached with WithMemoCacheErrors.
+func memoDo[K comparable, R any](ctx context.Context, mc *MemoCache[K], key K, cfg memoConfig, fn func(context.Context) R, failed func(R) bool) (R, error) {
+	if v, ok := mc.m.Get(key); ok {
+		return v.(R), nil
+	}
+	v, err := mc.group.do(ctx, key, func(ctx context.Context) (any, error) {
+		// a call that finished between the Get above and joining the group already cached it
+		if v, ok := mc.m.Peek(key); ok {
+			return v, nil
+		}
+		res := fn(ctx)
+		if failed == nil || cfg.cacheErrors || !failed(res) {
+			mc.store(key, max(cfg.ttl, 0), res)
+		}
+		return res, nil
+	})
+	if err != nil {
+		var p *flightPanic
+		if errors.As(err, &p) {
+			panic(p.value)
+		}
+		var zero R
+		return zero, err
+	}
+	return v.(R), nil
+}
+
+// memoCall is memoDo for functions with one result, a cancelled wait returns the zero value.
+func memoCall[K comparable, R any](mc *MemoCache[K], key K, cfg memoConfig, fn func() R, failed func(R) bool) R {
+	res, _ := memoDo(cfg.ctx, mc, key, cfg, func(context.Context) R { return fn() }, failed)
+	return res
+}
+
+// memoCallE is memoDo for the e variants, a cancelled wait returns the context error
+// as second value when its type is error.
+func memoCallE[K comparable, R1, R2 any](mc *MemoCache[K], key K, cfg memoConfig, fn func() (R1, R2)) (R1, R2) {
+	res, err := memoDo(cfg.ctx, mc, key, cfg, func(context.Context) memoPair[R1, R2] {
+		v1, v2 := fn()
+		return memoPair[R1, R2]{v1, v2}
+	}, memoPair[R1, R2].failed)
+	if err != nil {
+		if e, ok := err.(R2); ok {
+			res.v2 = e
+		}
+	}
+	return res.v1, res.v2
+}
+
+// memoCallCtx is memoDo for the Ctx variants, ctx only ends the wait of this call
+// and a cancelled wait returns its error.
+func memoCallCtx[K comparable, R any](ctx context.Context, mc *MemoCache[K], key K, fn func(context.Context) (R, error)) (R, error) {
+	res, err := memoDo(ctx, mc, key, mc.cfg, func(ctx context.Context) memoPair[R, error] {
+		v, err := fn(ctx)
+		return memoPair[R, error]{v, err}
+	}, memoPair[R, error].failed)
+	if err != nil {
+		return res.v1, err
+	}
+	return res.v1, res.v2
+}
+
+// NewMemo0 returns fn memoized with its own cache, for a function with no arguments and 1 return value.
+// Unlike Memo0 closures of one function literal do not share results.
+// example usage: get, cache := ez.NewMemo0(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo0[R any](fn func() R, opts ...MemoOption) (func() R, *MemoCache[struct{}]) {
+	mc := newMemoCache[struct{}](newMemoConfig(opts))
+	return func() R {
+		return memoCall(mc, struct{}{}, mc.cfg, fn, nil)
+	}, mc
+}
+
+// NewMemo0e returns fn memoized with its own cache, for a function with no arguments and 2 return values.
+// A non-nil error as second value is not cached unless WithMemoCacheErrors is set.
+// example usage: get, cache := ez.NewMemo0e(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo0e[R1, R2 any](fn func() (R1, R2), opts ...MemoOption) (func() (R1, R2), *MemoCache[struct{}]) {
+	mc := newMemoCache[struct{}](newMemoConfig(opts))
+	return func() (R1, R2) {
+		return memoCallE(mc, struct{}{}, mc.cfg, fn)
+	}, mc
+}
+
+// NewMemo1 returns fn memoized with its own cache, for a function with 1 argument and 1 return value.
+// Unlike Memo1 closures of one function literal do not share results.
+// example usage: fn, cache := ez.NewMemo1(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo1[A comparable, R any](fn func(A) R, opts ...MemoOption) (func(A) R, *MemoCache[A]) {
+	mc := newMemoCache[A](newMemoConfig(opts))
+	return func(arg A) R {
+		return memoCall(mc, arg, mc.cfg, func() R { return fn(arg) }, nil)
+	}, mc
+}
+
+// NewMemo1e returns fn memoized with its own cache, for a function with 1 argument and 2 return values.
+// A non-nil error as second value is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo1e(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo1e[A comparable, R1, R2 any](fn func(A) (R1, R2), opts ...MemoOption) (func(A) (R1, R2), *MemoCache[A]) {
+	mc := newMemoCache[A](newMemoConfig(opts))
+	return func(arg A) (R1, R2) {
+		return memoCallE(mc, arg, mc.cfg, func() (R1, R2) { return fn(arg) })
+	}, mc
+}
+
+// NewMemo2 returns fn memoized with its own cache, for a function with 2 arguments and 1 return value.
+// Unlike Memo2 closures of one function literal do not share results.
+// example usage: fn, cache := ez.NewMemo2(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo2[A, B comparable, R any](fn func(A, B) R, opts ...MemoOption) (func(A, B) R, *MemoCache[MemoArgs2[A, B]]) {
+	mc := newMemoCache[MemoArgs2[A, B]](newMemoConfig(opts))
+	return func(arg1 A, arg2 B) R {
+		return memoCall(mc, MemoArgs2[A, B]{arg1, arg2}, mc.cfg, func() R { return fn(arg1, arg2) }, nil)
+	}, mc
+}
+
+// NewMemo2e returns fn memoized with its own cache, for a function with 2 arguments and 2 return values.
+// A non-nil error as second value is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo2e(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo2e[A, B comparable, R1, R2 any](fn func(A, B) (R1, R2), opts ...MemoOption) (func(A, B) (R1, R2), *MemoCache[MemoArgs2[A, B]]) {
+	mc := newMemoCache[MemoArgs2[A, B]](newMemoConfig(opts))
+	return func(arg1 A, arg2 B) (R1, R2) {
+		return memoCallE(mc, MemoArgs2[A, B]{arg1, arg2}, mc.cfg, func() (R1, R2) { return fn(arg1, arg2) })
+	}, mc
+}
+
+// NewMemo3 returns fn memoized with its own cache, for a function with 3 arguments and 1 return value.
+// Unlike Memo3 closures of one function literal do not share results.
+// example usage: fn, cache := ez.NewMemo3(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo3[A, B, C comparable, R any](fn func(A, B, C) R, opts ...MemoOption) (func(A, B, C) R, *MemoCache[MemoArgs3[A, B, C]]) {
+	mc := newMemoCache[MemoArgs3[A, B, C]](newMemoConfig(opts))
+	return func(a A, b B, c C) R {
+		return memoCall(mc, MemoArgs3[A, B, C]{a, b, c}, mc.cfg, func() R { return fn(a, b, c) }, nil)
+	}, mc
+}
+
+// NewMemo3e returns fn memoized with its own cache, for a function with 3 arguments and 2 return values.
+// A non-nil error as second value is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo3e(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo3e[A, B, C comparable, R1, R2 any](fn func(A, B, C) (R1, R2), opts ...MemoOption) (func(A, B, C) (R1, R2), *MemoCache[MemoArgs3[A, B, C]]) {
+	mc := newMemoCache[MemoArgs3[A, B, C]](newMemoConfig(opts))
+	return func(a A, b B, c C) (R1, R2) {
+		return memoCallE(mc, MemoArgs3[A, B, C]{a, b, c}, mc.cfg, func() (R1, R2) { return fn(a, b, c) })
+	}, mc
+}
+
+// NewMemo4 returns fn memoized with its own cache, for a function with 4 arguments and 1 return value.
+// Unlike Memo4 closures of one function literal do not share results.
+// example usage: fn, cache := ez.NewMemo4(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo4[A, B, C, D comparable, R any](fn func(A, B, C, D) R, opts ...MemoOption) (func(A, B, C, D) R, *MemoCache[MemoArgs4[A, B, C, D]]) {
+	mc := newMemoCache[MemoArgs4[A, B, C, D]](newMemoConfig(opts))
+	return func(a A, b B, c C, d D) R {
+		return memoCall(mc, MemoArgs4[A, B, C, D]{a, b, c, d}, mc.cfg, func() R { return fn(a, b, c, d) }, nil)
+	}, mc
+}
+
+// NewMemo4e returns fn memoized with its own cache, for a function with 4 arguments and 2 return values.
+// A non-nil error as second value is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo4e(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo4e[A, B, C, D comparable, R1, R2 any](fn func(A, B, C, D) (R1, R2), opts ...MemoOption) (func(A, B, C, D) (R1, R2), *MemoCache[MemoArgs4[A, B, C, D]]) {
+	mc := newMemoCache[MemoArgs4[A, B, C, D]](newMemoConfig(opts))
+	return func(a A, b B, c C, d D) (R1, R2) {
+		return memoCallE(mc, MemoArgs4[A, B, C, D]{a, b, c, d}, mc.cfg, func() (R1, R2) { return fn(a, b, c, d) })
+	}, mc
+}
+
+// NewMemo5 returns fn memoized with its own cache, for a function with 5 arguments and 1 return value.
+// Unlike Memo5 closures of one function literal do not share results.
+// example usage: fn, cache := ez.NewMemo5(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo5[A, B, C, D, E comparable, R any](fn func(A, B, C, D, E) R, opts ...MemoOption) (func(A, B, C, D, E) R, *MemoCache[MemoArgs5[A, B, C, D, E]]) {
+	mc := newMemoCache[MemoArgs5[A, B, C, D, E]](newMemoConfig(opts))
+	return func(a A, b B, c C, d D, e E) R {
+		return memoCall(mc, MemoArgs5[A, B, C, D, E]{a, b, c, d, e}, mc.cfg, func() R { return fn(a, b, c, d, e) }, nil)
+	}, mc
+}
+
+// NewMemo5e returns fn memoized with its own cache, for a function with 5 arguments and 2 return values.
+// A non-nil error as second value is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo5e(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo5e[A, B, C, D, E comparable, R1, R2 any](fn func(A, B, C, D, E) (R1, R2), opts ...MemoOption) (func(A, B, C, D, E) (R1, R2), *MemoCache[MemoArgs5[A, B, C, D, E]]) {
+	mc := newMemoCache[MemoArgs5[A, B, C, D, E]](newMemoConfig(opts))
+	return func(a A, b B, c C, d D, e E) (R1, R2) {
+		return memoCallE(mc, MemoArgs5[A, B, C, D, E]{a, b, c, d, e}, mc.cfg, func() (R1, R2) { return fn(a, b, c, d, e) })
+	}, mc
+}
+
+// NewMemo6 returns fn memoized with its own cache, for a function with 6 arguments and 1 return value.
+// Unlike Memo6 closures of one function literal do not share results.
+// example usage: fn, cache := ez.NewMemo6(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo6[A, B, C, D, E, F comparable, R any](fn func(A, B, C, D, E, F) R, opts ...MemoOption) (func(A, B, C, D, E, F) R, *MemoCache[MemoArgs6[A, B, C, D, E, F]]) {
+	mc := newMemoCache[MemoArgs6[A, B, C, D, E, F]](newMemoConfig(opts))
+	return func(a A, b B, c C, d D, e E, f F) R {
+		return memoCall(mc, MemoArgs6[A, B, C, D, E, F]{a, b, c, d, e, f}, mc.cfg, func() R { return fn(a, b, c, d, e, f) }, nil)
+	}, mc
+}
+
+// NewMemo6e returns fn memoized with its own cache, for a function with 6 arguments and 2 return values.
+// A non-nil error as second value is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo6e(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo6e[A, B, C, D, E, F comparable, R1, R2 any](fn func(A, B, C, D, E, F) (R1, R2), opts ...MemoOption) (func(A, B, C, D, E, F) (R1, R2), *MemoCache[MemoArgs6[A, B, C, D, E, F]]) {
+	mc := newMemoCache[MemoArgs6[A, B, C, D, E, F]](newMemoConfig(opts))
+	return func(a A, b B, c C, d D, e E, f F) (R1, R2) {
+		return memoCallE(mc, MemoArgs6[A, B, C, D, E, F]{a, b, c, d, e, f}, mc.cfg, func() (R1, R2) { return fn(a, b, c, d, e, f) })
+	}, mc
+}
+
+// NewMemo7 returns fn memoized with its own cache, for a function with 7 arguments and 1 return value.
+// Unlike Memo7 closures of one function literal do not share results.
+// example usage: fn, cache := ez.NewMemo7(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo7[A, B, C, D, E, F, G comparable, R any](fn func(A, B, C, D, E, F, G) R, opts ...MemoOption) (func(A, B, C, D, E, F, G) R, *MemoCache[MemoArgs7[A, B, C, D, E, F, G]]) {
+	mc := newMemoCache[MemoArgs7[A, B, C, D, E, F, G]](newMemoConfig(opts))
+	return func(a A, b B, c C, d D, e E, f F, g G) R {
+		return memoCall(mc, MemoArgs7[A, B, C, D, E, F, G]{a, b, c, d, e, f, g}, mc.cfg, func() R { return fn(a, b, c, d, e, f, g) }, nil)
+	}, mc
+}
+
+// NewMemo7e returns fn memoized with its own cache, for a function with 7 arguments and 2 return values.
+// A non-nil error as second value is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo7e(funchere, ez.WithMemoTTL(time.Minute))
+func NewMemo7e[A, B, C, D, E, F, G comparable, R1, R2 any](fn func(A, B, C, D, E, F, G) (R1, R2), opts ...MemoOption) (func(A, B, C, D, E, F, G) (R1, R2), *MemoCache[MemoArgs7[A, B, C, D, E, F, G]]) {
+	mc := newMemoCache[MemoArgs7[A, B, C, D, E, F, G]](newMemoConfig(opts))
+	return func(a A, b B, c C, d D, e E, f F, g G) (R1, R2) {
+		return memoCallE(mc, MemoArgs7[A, B, C, D, E, F, G]{a, b, c, d, e, f, g}, mc.cfg, func() (R1, R2) { return fn(a, b, c, d, e, f, g) })
+	}, mc
+}
+
+// NewMemo0Ctx returns fn memoized with its own cache, for a function with a context, no arguments and a value and error result.
+// The context of a call only ends its wait, fn gets it without the cancellation so the shared result is still cached.
+// A cancelled wait returns the context error. An error from fn is not cached unless WithMemoCacheErrors is set.
+// example usage: get, cache := ez.NewMemo0Ctx(funchere)
+func NewMemo0Ctx[R any](fn func(context.Context) (R, error), opts ...MemoOption) (func(context.Context) (R, error), *MemoCache[struct{}]) {
+	mc := newMemoCache[struct{}](newMemoConfig(opts))
+	return func(ctx context.Context) (R, error) {
+		return memoCallCtx(ctx, mc, struct{}{}, func(ctx context.Context) (R, error) { return fn(ctx) })
+	}, mc
+}
+
+// NewMemo1Ctx returns fn memoized with its own cache, for a function with a context, 1 argument and a value and error result.
+// The context of a call only ends its wait, fn gets it without the cancellation so the shared result is still cached.
+// A cancelled wait returns the context error. An error from fn is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo1Ctx(funchere)
+func NewMemo1Ctx[A comparable, R any](fn func(context.Context, A) (R, error), opts ...MemoOption) (func(context.Context, A) (R, error), *MemoCache[A]) {
+	mc := newMemoCache[A](newMemoConfig(opts))
+	return func(ctx context.Context, arg A) (R, error) {
+		return memoCallCtx(ctx, mc, arg, func(ctx context.Context) (R, error) { return fn(ctx, arg) })
+	}, mc
+}
+
+// NewMemo2Ctx returns fn memoized with its own cache, for a function with a context, 2 arguments and a value and error result.
+// The context of a call only ends its wait, fn gets it without the cancellation so the shared result is still cached.
+// A cancelled wait returns the context error. An error from fn is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo2Ctx(funchere)
+func NewMemo2Ctx[A, B comparable, R any](fn func(context.Context, A, B) (R, error), opts ...MemoOption) (func(context.Context, A, B) (R, error), *MemoCache[MemoArgs2[A, B]]) {
+	mc := newMemoCache[MemoArgs2[A, B]](newMemoConfig(opts))
+	return func(ctx context.Context, arg1 A, arg2 B) (R, error) {
+		return memoCallCtx(ctx, mc, MemoArgs2[A, B]{arg1, arg2}, func(ctx context.Context) (R, error) { return fn(ctx, arg1, arg2) })
+	}, mc
+}
+
+// NewMemo3Ctx returns fn memoized with its own cache, for a function with a context, 3 arguments and a value and error result.
+// The context of a call only ends its wait, fn gets it without the cancellation so the shared result is still cached.
+// A cancelled wait returns the context error. An error from fn is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo3Ctx(funchere)
+func NewMemo3Ctx[A, B, C comparable, R any](fn func(context.Context, A, B, C) (R, error), opts ...MemoOption) (func(context.Context, A, B, C) (R, error), *MemoCache[MemoArgs3[A, B, C]]) {
+	mc := newMemoCache[MemoArgs3[A, B, C]](newMemoConfig(opts))
+	return func(ctx context.Context, a A, b B, c C) (R, error) {
+		return memoCallCtx(ctx, mc, MemoArgs3[A, B, C]{a, b, c}, func(ctx context.Context) (R, error) { return fn(ctx, a, b, c) })
+	}, mc
+}
+
+// NewMemo4Ctx returns fn memoized with its own cache, for a function with a context, 4 arguments and a value and error result.
+// The context of a call only ends its wait, fn gets it without the cancellation so the shared result is still cached.
+// A cancelled wait returns the context error. An error from fn is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo4Ctx(funchere)
+func NewMemo4Ctx[A, B, C, D comparable, R any](fn func(context.Context, A, B, C, D) (R, error), opts ...MemoOption) (func(context.Context, A, B, C, D) (R, error), *MemoCache[MemoArgs4[A, B, C, D]]) {
+	mc := newMemoCache[MemoArgs4[A, B, C, D]](newMemoConfig(opts))
+	return func(ctx context.Context, a A, b B, c C, d D) (R, error) {
+		return memoCallCtx(ctx, mc, MemoArgs4[A, B, C, D]{a, b, c, d}, func(ctx context.Context) (R, error) { return fn(ctx, a, b, c, d) })
+	}, mc
+}
+
+// NewMemo5Ctx returns fn memoized with its own cache, for a function with a context, 5 arguments and a value and error result.
+// The context of a call only ends its wait, fn gets it without the cancellation so the shared result is still cached.
+// A cancelled wait returns the context error. An error from fn is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo5Ctx(funchere)
+func NewMemo5Ctx[A, B, C, D, E comparable, R any](fn func(context.Context, A, B, C, D, E) (R, error), opts ...MemoOption) (func(context.Context, A, B, C, D, E) (R, error), *MemoCache[MemoArgs5[A, B, C, D, E]]) {
+	mc := newMemoCache[MemoArgs5[A, B, C, D, E]](newMemoConfig(opts))
+	return func(ctx context.Context, a A, b B, c C, d D, e E) (R, error) {
+		return memoCallCtx(ctx, mc, MemoArgs5[A, B, C, D, E]{a, b, c, d, e}, func(ctx context.Context) (R, error) { return fn(ctx, a, b, c, d, e) })
+	}, mc
+}
+
+// NewMemo6Ctx returns fn memoized with its own cache, for a function with a context, 6 arguments and a value and error result.
+// The context of a call only ends its wait, fn gets it without the cancellation so the shared result is still cached.
+// A cancelled wait returns the context error. An error from fn is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo6Ctx(funchere)
+func NewMemo6Ctx[A, B, C, D, E, F comparable, R any](fn func(context.Context, A, B, C, D, E, F) (R, error), opts ...MemoOption) (func(context.Context, A, B, C, D, E, F) (R, error), *MemoCache[MemoArgs6[A, B, C, D, E, F]]) {
+	mc := newMemoCache[MemoArgs6[A, B, C, D, E, F]](newMemoConfig(opts))
+	return func(ctx context.Context, a A, b B, c C, d D, e E, f F) (R, error) {
+		return memoCallCtx(ctx, mc, MemoArgs6[A, B, C, D, E, F]{a, b, c, d, e, f}, func(ctx context.Context) (R, error) { return fn(ctx, a, b, c, d, e, f) })
+	}, mc
+}
+
+// NewMemo7Ctx returns fn memoized with its own cache, for a function with a context, 7 arguments and a value and error result.
+// The context of a call only ends its wait, fn gets it without the cancellation so the shared result is still cached.
+// A cancelled wait returns the context error. An error from fn is not cached unless WithMemoCacheErrors is set.
+// example usage: fn, cache := ez.NewMemo7Ctx(funchere)
+func NewMemo7Ctx[A, B, C, D, E, F, G comparable, R any](fn func(context.Context, A, B, C, D, E, F, G) (R, error), opts ...MemoOption) (func(context.Context, A, B, C, D, E, F, G) (R, error), *MemoCache[MemoArgs7[A, B, C, D, E, F, G]]) {
+	mc := newMemoCache[MemoArgs7[A, B, C, D, E, F, G]](newMemoConfig(opts))
+	return func(ctx context.Context, a A, b B, c C, d D, e E, f F, g G) (R, error) {
+		return memoCallCtx(ctx, mc, MemoArgs7[A, B, C, D, E, F, G]{a, b, c, d, e, f, g}, func(ctx context.Context) (R, error) { return fn(ctx, a, b, c, d, e, f, g) })
+	}, mc
+}
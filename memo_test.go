@@ -0,0 +1,94 @@
+package ez
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoKeepsPanicValue(t *testing.T) {
+	sentinel := errors.New("boom")
+	fn, _ := NewMemo1(func(n int) int { panic(sentinel) })
+	defer func() {
+		if r := recover(); r != sentinel {
+			t.Fatalf("recovered %v, want the original panic value", r)
+		}
+	}()
+	fn(1)
+}
+
+func TestMemoCtxCancelledWait(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fn, _ := NewMemo1Ctx(func(ctx context.Context, n int) (int, error) {
+		calls.Add(1)
+		<-release
+		return n * 2, nil
+	})
+
+	started := make(chan struct{})
+	done := make(chan int)
+	go func() {
+		close(started)
+		v, _ := fn(context.Background(), 21)
+		done <- v
+	}()
+	<-started
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fn(ctx, 21); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled call returned %v, want context.Canceled", err)
+	}
+	close(release)
+	if v := <-done; v != 42 {
+		t.Fatalf("first call returned %d, want 42", v)
+	}
+	// a new call after the cancelled one uses the cached result
+	if v, err := fn(context.Background(), 21); v != 42 || err != nil || calls.Load() != 1 {
+		t.Fatalf("got %d, %v after %d calls, want 42, nil after 1", v, err, calls.Load())
+	}
+}
+
+func TestMemoKeysOnArguments(t *testing.T) {
+	calls := 0
+	join, _ := NewMemo1(func(a [2]string) string {
+		calls++
+		return a[0] + "|" + a[1]
+	})
+	if got := join([2]string{"a b", "c"}); got != "a b|c" {
+		t.Fatalf("join = %q, want a b|c", got)
+	}
+	if got := join([2]string{"a", "b c"}); got != "a|b c" {
+		t.Fatalf("join = %q, want a|b c", got)
+	}
+	if calls != 2 {
+		t.Fatalf("fn ran %d times, want 2", calls)
+	}
+
+	pair, cache := NewMemo2(func(a any, b string) string { return fmt.Sprint(a) + b })
+	pair(1, "x")
+	pair("1", "x")
+	if cache.Len() != 2 {
+		t.Fatalf("Len() = %d, want 1 and \"1\" cached apart", cache.Len())
+	}
+	cache.Forget(MemoArgs2[any, string]{1, "x"})
+	if cache.Len() != 1 {
+		t.Fatalf("Len() = %d after Forget, want 1", cache.Len())
+	}
+}
+
+func TestMemoForgetTyped(t *testing.T) {
+	square, cache := NewMemo1(func(n int64) int64 { return n * n })
+	square(5)
+	cache.Forget(5)
+	if cache.Len() != 0 {
+		t.Fatalf("Len() = %d after Forget(5) on an int64 cache, want 0", cache.Len())
+	}
+}
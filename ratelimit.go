@@ -0,0 +1,214 @@
+package ez
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateAlgorithm picks how a RateLimiter counts requests
+type RateAlgorithm int
+
+const (
+	// TokenBucket refills limit tokens per window and allows bursts up to the bucket size
+	TokenBucket RateAlgorithm = iota
+	// SlidingWindow allows limit requests in any window, weighting the previous window by how much of it still overlaps
+	SlidingWindow
+)
+
+func (a RateAlgorithm) String() string {
+	switch a {
+	case TokenBucket:
+		return "token-bucket"
+	case SlidingWindow:
+		return "sliding-window"
+	default:
+		return "unknown"
+	}
+}
+
+// RateLimiter limits requests per key (IP, API key, user ID).
+// The state lives in a SafeMapOf with a TTL so idle keys are cleaned up by the janitor.
+type RateLimiter struct {
+	m         *SafeMapOf[string, rateState]
+	algorithm RateAlgorithm
+	limit     int
+	window    time.Duration
+	burst     int
+}
+
+// rateState is the per key state, tokens/last for TokenBucket and start/cur/prev for SlidingWindow.
+type rateState struct {
+	tokens float64
+	last   time.Time
+	start  time.Time
+	cur    int
+	prev   int
+}
+
+// RateLimitOption configures a RateLimiter
+type RateLimitOption func(*RateLimiter)
+
+// WithRateAlgorithm switches the limiter between TokenBucket (default) and SlidingWindow.
+// example usage: l := ez.NewRateLimiter(100, time.Minute, ez.WithRateAlgorithm(ez.SlidingWindow))
+func WithRateAlgorithm(a RateAlgorithm) RateLimitOption {
+	return func(l *RateLimiter) {
+		l.algorithm = a
+	}
+}
+
+// WithBurst sets the token bucket size, by default it holds limit tokens.
+// example usage: l := ez.NewRateLimiter(10, time.Second, ez.WithBurst(50))
+func WithBurst(n int) RateLimitOption {
+	return func(l *RateLimiter) {
+		l.burst = n
+	}
+}
+
+// NewRateLimiter allows limit requests per window for every key.
+// Call Close when the limiter is no longer needed to stop its janitor.
+// example usage: l := ez.NewRateLimiter(100, time.Minute)
+func NewRateLimiter(limit int, window time.Duration, opts ...RateLimitOption) *RateLimiter {
+	l := &RateLimiter{
+		m:      NewSafeMapOf[string, rateState](16, WithQuiet()),
+		limit:  max(limit, 1),
+		window: window,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.burst <= 0 {
+		l.burst = l.limit
+	}
+	if l.window <= 0 {
+		l.window = time.Second
+	}
+	return l
+}
+
+// Allow reports whether a request for key may go through and uses it up if so.
+// example usage: if !l.Allow(apiKey) { return errTooManyRequests }
+func (l *RateLimiter) Allow(key string) bool {
+	ok, _ := l.Reserve(key)
+	return ok
+}
+
+// Reserve is Allow that also says how long to wait before the next request
+// for key can succeed when this one is refused.
+// example usage: ok, wait := l.Reserve(ip)
+func (l *RateLimiter) Reserve(key string) (bool, time.Duration) {
+	var allowed bool
+	var retry time.Duration
+	now := l.m.now()
+	l.m.Update(key, func(st rateState, ok bool) (rateState, bool) {
+		if l.algorithm == SlidingWindow {
+			allowed, retry = l.slidingWindow(&st, ok, now)
+		} else {
+			allowed, retry = l.tokenBucket(&st, ok, now)
+		}
+		return st, true
+	})
+	l.m.Touch(key, l.idle())
+	return allowed, retry
+}
+
+// Reset forgets everything the limiter knows about key.
+// example usage: l.Reset(userID)
+func (l *RateLimiter) Reset(key string) {
+	l.m.Delete(key)
+}
+
+// Close stops the janitor of the limiter.
+func (l *RateLimiter) Close() error {
+	return l.m.Close()
+}
+
+func (l *RateLimiter) tokenBucket(st *rateState, ok bool, now time.Time) (bool, time.Duration) {
+	perToken := l.window / time.Duration(l.limit)
+	if !ok {
+		st.tokens, st.last = float64(l.burst), now
+	}
+	if elapsed := now.Sub(st.last); elapsed > 0 && perToken > 0 {
+		st.tokens = math.Min(float64(l.burst), st.tokens+float64(elapsed)/float64(perToken))
+	} else if perToken <= 0 {
+		st.tokens = float64(l.burst)
+	}
+	st.last = now
+	if st.tokens >= 1 {
+		st.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - st.tokens) * float64(perToken))
+}
+
+func (l *RateLimiter) slidingWindow(st *rateState, ok bool, now time.Time) (bool, time.Duration) {
+	if !ok {
+		st.start = now
+	}
+	// roll the windows forward, a gap of two or more windows clears both
+	if elapsed := now.Sub(st.start); elapsed >= l.window {
+		if elapsed >= 2*l.window {
+			st.prev = 0
+		} else {
+			st.prev = st.cur
+		}
+		st.cur = 0
+		st.start = st.start.Add(elapsed / l.window * l.window)
+	}
+
+	elapsed := now.Sub(st.start)
+	weight := 1 - float64(elapsed)/float64(l.window)
+	if float64(st.prev)*weight+float64(st.cur) < float64(l.limit) {
+		st.cur++
+		return true, 0
+	}
+	left := l.window - elapsed
+	if st.cur >= l.limit || st.prev == 0 {
+		return false, left
+	}
+	// wait until enough of the previous window has slid out
+	need := 1 - float64(l.limit-st.cur)/float64(st.prev)
+	return false, max(time.Duration(need*float64(l.window))-elapsed, time.Millisecond)
+}
+
+// idle is how long a key may go unused before its state no longer matters.
+func (l *RateLimiter) idle() time.Duration {
+	if l.algorithm == SlidingWindow {
+		return 2 * l.window
+	}
+	return max(l.window/time.Duration(l.limit)*time.Duration(l.burst), time.Second)
+}
+
+// Middleware refuses requests over the limit with 429 Too Many Requests and a Retry-After header.
+// keyFn picks the key of a request, nil limits by client IP.
+// example usage: http.ListenAndServe(":8080", l.Middleware(nil)(mux))
+func (l *RateLimiter) Middleware(keyFn func(r *http.Request) string) func(http.Handler) http.Handler {
+	if keyFn == nil {
+		keyFn = ClientIP
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait := l.Reserve(keyFn(r))
+			if !ok {
+				secs := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(max(secs, 1)))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the IP of the remote end of the request without the port.
+// Proxy headers are not trusted, wrap it yourself when running behind one.
+// example usage: ip := ez.ClientIP(r)
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,132 @@
+package ez
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter whose state map runs on clock.
+func newTestLimiter(clock *fakeClock, limit int, window time.Duration, opts ...RateLimitOption) *RateLimiter {
+	l := NewRateLimiter(limit, window, opts...)
+	l.m.Close()
+	l.m = NewSafeMapOf[string, rateState](1, WithClock(clock.Now), WithJanitorInterval(0), WithQuiet())
+	return l
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l := newTestLimiter(clock, 10, time.Second)
+	defer l.Close()
+
+	for i := 0; i < 10; i++ {
+		if !l.Allow("ip") {
+			t.Fatalf("request %d of a full bucket refused", i+1)
+		}
+	}
+	if ok, wait := l.Reserve("ip"); ok || wait != 100*time.Millisecond {
+		t.Fatalf("Reserve on an empty bucket = %v, %v, want false, 100ms", ok, wait)
+	}
+	clock.Add(50 * time.Millisecond)
+	if ok, wait := l.Reserve("ip"); ok || wait != 50*time.Millisecond {
+		t.Fatalf("Reserve half a token later = %v, %v, want false, 50ms", ok, wait)
+	}
+	clock.Add(50 * time.Millisecond)
+	if !l.Allow("ip") {
+		t.Fatal("request refused after a token refilled")
+	}
+	if !l.Allow("other") {
+		t.Fatal("a key shares the bucket of another")
+	}
+	l.Reset("ip")
+	if !l.Allow("ip") {
+		t.Fatal("request refused after Reset")
+	}
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l := newTestLimiter(clock, 1, time.Second, WithBurst(3))
+	defer l.Close()
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("ip") {
+			t.Fatalf("request %d of a burst of 3 refused", i+1)
+		}
+	}
+	if l.Allow("ip") {
+		t.Fatal("request over the burst allowed")
+	}
+	// a long pause refills to the burst size, not beyond
+	clock.Add(time.Minute)
+	allowed := 0
+	for l.Allow("ip") {
+		allowed++
+	}
+	if allowed != 3 {
+		t.Fatalf("%d requests allowed after a long pause, want the burst of 3", allowed)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l := newTestLimiter(clock, 4, 10*time.Second, WithRateAlgorithm(SlidingWindow))
+	defer l.Close()
+
+	for i := 0; i < 4; i++ {
+		if !l.Allow("ip") {
+			t.Fatalf("request %d of 4 refused", i+1)
+		}
+	}
+	clock.Add(2 * time.Second)
+	if ok, wait := l.Reserve("ip"); ok || wait != 8*time.Second {
+		t.Fatalf("Reserve over the limit = %v, %v, want false and the 8s left of the window", ok, wait)
+	}
+
+	// 80% of the previous window still counts, so one request fits
+	clock.Add(10 * time.Second)
+	if !l.Allow("ip") {
+		t.Fatal("request refused with a fifth of the previous window slid out")
+	}
+	if ok, wait := l.Reserve("ip"); ok || wait != 500*time.Millisecond {
+		t.Fatalf("Reserve = %v, %v, want false, 500ms until less than 75%% of the previous window is left", ok, wait)
+	}
+	clock.Add(501 * time.Millisecond)
+	if !l.Allow("ip") {
+		t.Fatal("request refused after the suggested wait")
+	}
+
+	// two idle windows forget everything
+	clock.Add(20 * time.Second)
+	for i := 0; i < 4; i++ {
+		if !l.Allow("ip") {
+			t.Fatalf("request %d refused after two idle windows", i+1)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l := newTestLimiter(clock, 1, 3*time.Second)
+	defer l.Close()
+	h := l.Middleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(addr string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = addr
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+	if rec := serve("10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", rec.Code)
+	}
+	rec := serve("10.0.0.1:5678")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3" {
+		t.Fatalf("second request = %d with Retry-After %q, want 429 and 3", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("request from another IP = %d, want 200", rec.Code)
+	}
+}
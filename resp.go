@@ -0,0 +1,517 @@
+package ez
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeRESP accepts connections on l and answers Redis RESP2 commands from m,
+// so any Redis client can share one SafeMap between processes.
+// Supported: PING, ECHO, GET, SET (EX/PX), DEL, EXISTS, TTL, PTTL, EXPIRE, PEXPIRE, PERSIST,
+// INCR, INCRBY, DECR, DECRBY, KEYS, SCAN, DBSIZE, FLUSHDB, QUIT.
+// It blocks until l is closed and returns the Accept error.
+// example usage: l, _ := net.Listen("tcp", "127.0.0.1:6380"); go ez.ServeRESP(l, m)
+func ServeRESP(l net.Listener, m *SafeMap) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveRESPConn(conn, m)
+	}
+}
+
+func serveRESPConn(conn net.Conn, m *SafeMap) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				writeRESPError(w, "ERR Protocol error: "+err.Error())
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := execRESP(w, m, args)
+		// flush once the pipeline is drained so batched commands share a write
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		// inline command, as typed into telnet
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > 1024*1024 {
+		return nil, fmt.Errorf("invalid multibulk length")
+	}
+	// the header is only a claim, args grows as the arguments arrive
+	var args []string
+	for i := 0; i < n; i++ {
+		line, err := readRESPLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("expected '$', got '%s'", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > 512*1024*1024 {
+			return nil, fmt.Errorf("invalid bulk length")
+		}
+		// grow with the data that actually arrives instead of trusting the declared size
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, int64(size)); err != nil {
+			return nil, err
+		}
+		crlf := make([]byte, 2)
+		if _, err := io.ReadFull(r, crlf); err != nil {
+			return nil, err
+		}
+		if string(crlf) != "\r\n" {
+			return nil, fmt.Errorf("expected CRLF after bulk string")
+		}
+		args = append(args, buf.String())
+	}
+	return args, nil
+}
+
+// respMaxLine caps inline commands and header lines like Redis does.
+const respMaxLine = 64 * 1024
+
+func readRESPLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > respMaxLine {
+			return "", fmt.Errorf("line longer than %d bytes", respMaxLine)
+		}
+		line = append(line, chunk...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+func writeRESPSimple(w *bufio.Writer, s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func writeRESPError(w *bufio.Writer, s string) {
+	w.WriteString("-" + s + "\r\n")
+}
+
+func writeRESPInt(w *bufio.Writer, n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func writeRESPBulk(w *bufio.Writer, s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func writeRESPNil(w *bufio.Writer) {
+	w.WriteString("$-1\r\n")
+}
+
+func writeRESPArray(w *bufio.Writer, items []string) {
+	w.WriteString("*" + strconv.Itoa(len(items)) + "\r\n")
+	for _, it := range items {
+		writeRESPBulk(w, it)
+	}
+}
+
+// respString renders a stored value as a Redis string.
+func respString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+const respWrongArgs = "ERR wrong number of arguments for '%s' command"
+
+// execRESP runs one command and writes its reply, it returns true when the connection should close.
+func execRESP(w *bufio.Writer, m *SafeMap, args []string) bool {
+	cmd := strings.ToUpper(args[0])
+	argc := len(args)
+	wrongArgs := func() {
+		writeRESPError(w, fmt.Sprintf(respWrongArgs, strings.ToLower(cmd)))
+	}
+
+	switch cmd {
+	case "PING":
+		switch argc {
+		case 1:
+			writeRESPSimple(w, "PONG")
+		case 2:
+			writeRESPBulk(w, args[1])
+		default:
+			wrongArgs()
+		}
+	case "ECHO":
+		if argc != 2 {
+			wrongArgs()
+			break
+		}
+		writeRESPBulk(w, args[1])
+	case "QUIT":
+		writeRESPSimple(w, "OK")
+		return true
+	case "SELECT", "CLIENT":
+		writeRESPSimple(w, "OK")
+	case "COMMAND":
+		writeRESPArray(w, nil)
+	case "GET":
+		if argc != 2 {
+			wrongArgs()
+			break
+		}
+		v, ok := m.Get(args[1])
+		if !ok {
+			writeRESPNil(w)
+			break
+		}
+		writeRESPBulk(w, respString(v))
+	case "SET":
+		if argc != 3 && argc != 5 {
+			wrongArgs()
+			break
+		}
+		var ttl time.Duration
+		if argc == 5 {
+			n, err := strconv.ParseInt(args[4], 10, 64)
+			var unit time.Duration
+			switch strings.ToUpper(args[3]) {
+			case "EX":
+				unit = time.Second
+			case "PX":
+				unit = time.Millisecond
+			default:
+				writeRESPError(w, "ERR syntax error")
+				return false
+			}
+			if err != nil || n <= 0 || n > math.MaxInt64/int64(unit) {
+				writeRESPError(w, "ERR invalid expire time in 'set' command")
+				break
+			}
+			ttl = time.Duration(n) * unit
+		}
+		m.InsertWithTTL(args[1], ttl, 0, args[2])
+		writeRESPSimple(w, "OK")
+	case "DEL":
+		if argc < 2 {
+			wrongArgs()
+			break
+		}
+		var n int64
+		for _, key := range args[1:] {
+			m.compute(key, func(cur interface{}, ok bool) (interface{}, updateOp) {
+				if !ok {
+					return cur, opNone
+				}
+				n++
+				return cur, opDelete
+			})
+		}
+		writeRESPInt(w, n)
+	case "EXISTS":
+		if argc < 2 {
+			wrongArgs()
+			break
+		}
+		var n int64
+		for _, key := range args[1:] {
+			if _, ok := m.Peek(key); ok {
+				n++
+			}
+		}
+		writeRESPInt(w, n)
+	case "TTL", "PTTL":
+		if argc != 2 {
+			wrongArgs()
+			break
+		}
+		left, ok := m.TTL(args[1])
+		switch {
+		case !ok:
+			writeRESPInt(w, -2)
+		case left == NoTTL:
+			writeRESPInt(w, -1)
+		case cmd == "TTL":
+			writeRESPInt(w, int64((left+time.Second/2)/time.Second))
+		default:
+			writeRESPInt(w, int64((left+time.Millisecond/2)/time.Millisecond))
+		}
+	case "EXPIRE", "PEXPIRE":
+		if argc != 3 {
+			wrongArgs()
+			break
+		}
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			writeRESPError(w, "ERR value is not an integer or out of range")
+			break
+		}
+		unit := time.Second
+		if cmd == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		if n <= 0 {
+			// like Redis, a non positive timeout deletes the key
+			if _, ok := m.Peek(args[1]); ok {
+				m.Delete(args[1])
+				writeRESPInt(w, 1)
+			} else {
+				writeRESPInt(w, 0)
+			}
+			break
+		}
+		if n > math.MaxInt64/int64(unit) {
+			writeRESPError(w, fmt.Sprintf("ERR invalid expire time in '%s' command", strings.ToLower(cmd)))
+			break
+		}
+		if m.Touch(args[1], time.Duration(n)*unit) {
+			writeRESPInt(w, 1)
+		} else {
+			writeRESPInt(w, 0)
+		}
+	case "PERSIST":
+		if argc != 2 {
+			wrongArgs()
+			break
+		}
+		left, ok := m.TTL(args[1])
+		if ok && left != NoTTL && m.Persist(args[1]) {
+			writeRESPInt(w, 1)
+		} else {
+			writeRESPInt(w, 0)
+		}
+	case "INCR", "DECR", "INCRBY", "DECRBY":
+		delta := int64(1)
+		if cmd == "INCRBY" || cmd == "DECRBY" {
+			if argc != 3 {
+				wrongArgs()
+				break
+			}
+			n, err := strconv.ParseInt(args[2], 10, 64)
+			if err != nil {
+				writeRESPError(w, "ERR value is not an integer or out of range")
+				break
+			}
+			delta = n
+		} else if argc != 2 {
+			wrongArgs()
+			break
+		}
+		if cmd == "DECR" || cmd == "DECRBY" {
+			if delta == math.MinInt64 {
+				writeRESPError(w, "ERR decrement would overflow")
+				break
+			}
+			delta = -delta
+		}
+		n, err := respIncr(m, args[1], delta)
+		if errors.Is(err, errRESPOverflow) {
+			writeRESPError(w, "ERR increment or decrement would overflow")
+			break
+		}
+		if err != nil {
+			writeRESPError(w, "ERR value is not an integer or out of range")
+			break
+		}
+		writeRESPInt(w, n)
+	case "KEYS":
+		if argc != 2 {
+			wrongArgs()
+			break
+		}
+		writeRESPArray(w, respKeys(m, args[1]))
+	case "SCAN":
+		if argc < 2 || argc%2 != 0 {
+			wrongArgs()
+			break
+		}
+		pattern := "*"
+		for i := 2; i+1 < argc; i += 2 {
+			switch strings.ToUpper(args[i]) {
+			case "MATCH":
+				pattern = args[i+1]
+			case "COUNT":
+				// a hint only, every key is returned in one pass
+			default:
+				writeRESPError(w, "ERR syntax error")
+				return false
+			}
+		}
+		w.WriteString("*2\r\n")
+		writeRESPBulk(w, "0")
+		writeRESPArray(w, respKeys(m, pattern))
+	case "DBSIZE":
+		writeRESPInt(w, int64(m.Len()))
+	case "FLUSHDB", "FLUSHALL":
+		m.Clear()
+		writeRESPSimple(w, "OK")
+	default:
+		writeRESPError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	return false
+}
+
+var errRESPOverflow = errors.New("increment or decrement would overflow")
+
+// respIncr adds delta to key, strings holding integers are kept as strings like in Redis.
+// A result outside int64, or outside the type of a stored number, is refused with errRESPOverflow.
+func respIncr(m *SafeMap, key string, delta int64) (int64, error) {
+	var result int64
+	var err error
+	m.compute(key, func(cur interface{}, ok bool) (interface{}, updateOp) {
+		if !ok {
+			result = delta
+			return strconv.FormatInt(delta, 10), opStore
+		}
+		n, parseErr := strconv.ParseInt(respString(cur), 10, 64)
+		if parseErr != nil {
+			err = parseErr
+			return cur, opNone
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			err = errRESPOverflow
+			return cur, opNone
+		}
+		result = n + delta
+		if _, isString := cur.(string); isString {
+			return strconv.FormatInt(result, 10), opStore
+		}
+		next, addErr := addNumber(cur, true, delta)
+		if addErr != nil {
+			err = addErr
+			return cur, opNone
+		}
+		// a narrower type than int64 wraps around silently
+		if respString(next) != strconv.FormatInt(result, 10) {
+			err = errRESPOverflow
+			return cur, opNone
+		}
+		return next, opStore
+	})
+	return result, err
+}
+
+func respKeys(m *SafeMap, pattern string) []string {
+	keys := []string{}
+	for key := range m.Keys() {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// globMatch reports whether s matches a Redis style glob pattern.
+// Supports *, ?, [abc], [^abc], [a-z] and backslash escapes.
+// Only the last * is remembered for backtracking, so it runs in O(len(pattern)*len(s)).
+func globMatch(pattern, s string) bool {
+	p, i := 0, 0
+	star, retry := -1, 0
+	for i < len(s) {
+		if p < len(pattern) && pattern[p] == '*' {
+			// let the star match nothing first, widen it by one byte on every mismatch
+			star, retry = p+1, i
+			p++
+			continue
+		}
+		if p < len(pattern) {
+			if n, ok := globStep(pattern[p:], s[i]); ok {
+				p, i = p+n, i+1
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		retry++
+		p, i = star, retry
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// globStep matches c against the first element of pattern, which is not a *,
+// and returns how many pattern bytes that element takes.
+func globStep(pattern string, c byte) (int, bool) {
+	switch pattern[0] {
+	case '?':
+		return 1, true
+	case '[':
+		end := strings.IndexByte(pattern[1:], ']')
+		if end < 0 {
+			// unterminated class, treat '[' literally
+			return 1, c == '['
+		}
+		class := pattern[1 : end+1]
+		negate := len(class) > 0 && class[0] == '^'
+		if negate {
+			class = class[1:]
+		}
+		matched := false
+		for i := 0; i < len(class); i++ {
+			if i+2 < len(class) && class[i+1] == '-' {
+				if class[i] <= c && c <= class[i+2] {
+					matched = true
+				}
+				i += 2
+				continue
+			}
+			if class[i] == c {
+				matched = true
+			}
+		}
+		return end + 2, matched != negate
+	case '\\':
+		if len(pattern) > 1 {
+			return 2, pattern[1] == c
+		}
+		return 1, c == '\\'
+	default:
+		return 1, pattern[0] == c
+	}
+}
@@ -0,0 +1,200 @@
+package ez
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// respClient talks to serveRESPConn over an in-memory pipe.
+type respClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRESPClient(t *testing.T, m *SafeMap) *respClient {
+	t.Helper()
+	client, server := net.Pipe()
+	go serveRESPConn(server, m)
+	t.Cleanup(func() { client.Close() })
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	return &respClient{t: t, conn: client, r: bufio.NewReader(client)}
+}
+
+// do sends args as a multibulk command and returns the first reply line.
+func (c *respClient) do(args ...string) string {
+	c.t.Helper()
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		b.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	return c.raw(b.String())
+}
+
+func (c *respClient) raw(s string) string {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(s)); err != nil {
+		c.t.Fatalf("write %q: %v", s, err)
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read reply to %q: %v", s, err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "$") && line != "$-1" {
+		body, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("read bulk reply to %q: %v", s, err)
+		}
+		return strings.TrimRight(body, "\r\n")
+	}
+	return line
+}
+
+func TestRESPCommands(t *testing.T) {
+	m := NewSafeMap(4, WithQuiet())
+	defer m.Close()
+	c := newRESPClient(t, m)
+
+	steps := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"GET", "a"}, "$-1"},
+		{[]string{"SET", "a", "hello"}, "+OK"},
+		{[]string{"GET", "a"}, "hello"},
+		{[]string{"EXPIRE", "a", "100"}, ":1"},
+		{[]string{"EXPIRE", "missing", "100"}, ":0"},
+		{[]string{"DEL", "a", "missing"}, ":1"},
+		{[]string{"GET", "a"}, "$-1"},
+		{[]string{"INCR", "n"}, ":1"},
+		{[]string{"INCRBY", "n", "41"}, ":42"},
+		{[]string{"DECR", "n"}, ":41"},
+		{[]string{"SET", "big", "9223372036854775807"}, "+OK"},
+		{[]string{"INCR", "big"}, "-ERR increment or decrement would overflow"},
+		{[]string{"GET", "big"}, "9223372036854775807"},
+		{[]string{"DECRBY", "n", "-9223372036854775808"}, "-ERR decrement would overflow"},
+		{[]string{"INCR", "hello"}, ":1"},
+		{[]string{"SET", "s", "abc"}, "+OK"},
+		{[]string{"INCR", "s"}, "-ERR value is not an integer or out of range"},
+		{[]string{"NOPE"}, "-ERR unknown command 'NOPE'"},
+	}
+	for _, st := range steps {
+		if got := c.do(st.args...); got != st.want {
+			t.Fatalf("%v = %q, want %q", st.args, got, st.want)
+		}
+	}
+}
+
+func TestRESPIncrNarrowType(t *testing.T) {
+	m := NewSafeMap(1, WithQuiet())
+	defer m.Close()
+	m.Insert("small", 0, int8(127))
+	if _, err := respIncr(m, "small", 1); err != errRESPOverflow {
+		t.Fatalf("respIncr on int8(127) = %v, want errRESPOverflow", err)
+	}
+	if v, _ := m.Get("small"); v != int8(127) {
+		t.Fatalf("value = %v after refused INCR, want 127", v)
+	}
+}
+
+func TestRESPMalformedInput(t *testing.T) {
+	m := NewSafeMap(1, WithQuiet())
+	defer m.Close()
+
+	for _, in := range []string{
+		"*1\r\n+PING\r\n",
+		"*x\r\n",
+		"*1\r\n$-5\r\n",
+		"*1\r\n$4\r\nPINGxx",
+	} {
+		c := newRESPClient(t, m)
+		if got := c.raw(in); !strings.HasPrefix(got, "-ERR Protocol error") {
+			t.Errorf("%q answered %q, want a protocol error", in, got)
+		}
+	}
+}
+
+func TestRESPTruncatedHugeBulk(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*1\r\n$536870912\r\nshort"))
+	if _, err := readRESPCommand(r); err == nil {
+		t.Fatal("readRESPCommand accepted a truncated 512MB bulk string")
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "abc", true},
+		{"a*", "abc", true},
+		{"*c", "abc", true},
+		{"a*c", "ac", true},
+		{"a*c", "abd", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[llo", "h[llo", true},
+		{`a\*b`, "a*b", true},
+		{`a\*b`, "axb", false},
+		{"*a*b*", "xxaxxbxx", true},
+		{"user:*:name", "user:42:name", true},
+		{"user:*:name", "user:42:mail", false},
+	}
+	for _, c := range cases {
+		if got := globMatch(c.pattern, c.s); got != c.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+		}
+	}
+}
+
+func TestGlobMatchPathologicalPattern(t *testing.T) {
+	done := make(chan bool)
+	go func() {
+		done <- globMatch("*a*a*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 40))
+	}()
+	select {
+	case got := <-done:
+		if got {
+			t.Fatal("pattern ending in b matched a string of a's")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("globMatch backtracks exponentially")
+	}
+}
+
+func TestRESPLimits(t *testing.T) {
+	m := NewSafeMap(1, WithQuiet())
+	defer m.Close()
+	c := newRESPClient(t, m)
+
+	for _, st := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SET", "j", "v", "EX", "99999999999"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "j", "v"}, "+OK"},
+		{[]string{"EXPIRE", "j", "99999999999"}, "-ERR invalid expire time in 'expire' command"},
+		{[]string{"PEXPIRE", "j", "9223372036854775807"}, "-ERR invalid expire time in 'pexpire' command"},
+		{[]string{"TTL", "j"}, ":-1"},
+	} {
+		if got := c.do(st.args...); got != st.want {
+			t.Fatalf("%v = %q, want %q", st.args, got, st.want)
+		}
+	}
+
+	long := bufio.NewReader(strings.NewReader(strings.Repeat("x", respMaxLine+1) + "\r\n"))
+	if _, err := readRESPCommand(long); err == nil {
+		t.Fatal("readRESPCommand accepted a line over 64KB")
+	}
+}
@@ -0,0 +1,469 @@
+package ez
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SessionData is what a SessionStore keeps for one session
+type SessionData struct {
+	Values  map[string]interface{} `bson:"values" json:"values"`
+	Flashes []string               `bson:"flashes" json:"flashes"`
+}
+
+// SessionStore keeps session data by ID. Every ttl is a sliding window,
+// Touch is called on requests that did not change the session.
+type SessionStore interface {
+	Load(ctx context.Context, id string) (SessionData, bool, error)
+	Save(ctx context.Context, id string, data SessionData, ttl time.Duration) error
+	Touch(ctx context.Context, id string, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+// MemorySessionStore keeps sessions in a SafeMapOf with sliding expiry
+type MemorySessionStore struct {
+	m *SafeMapOf[string, SessionData]
+}
+
+// NewMemorySessionStore creates the default in process session store.
+// example usage: store := ez.NewMemorySessionStore()
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{m: NewSafeMapOf[string, SessionData](16, WithQuiet())}
+}
+
+func (s *MemorySessionStore) Load(ctx context.Context, id string) (SessionData, bool, error) {
+	data, ok := s.m.Get(id)
+	return data, ok, nil
+}
+
+func (s *MemorySessionStore) Save(ctx context.Context, id string, data SessionData, ttl time.Duration) error {
+	data.Values = maps.Clone(data.Values)
+	data.Flashes = slices.Clone(data.Flashes)
+	s.m.InsertSliding(id, ttl, 0, data)
+	return nil
+}
+
+func (s *MemorySessionStore) Touch(ctx context.Context, id string, ttl time.Duration) error {
+	s.m.Touch(id, ttl)
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.m.Delete(id)
+	return nil
+}
+
+// Close stops the janitor of the store.
+func (s *MemorySessionStore) Close() error {
+	return s.m.Close()
+}
+
+// MongoSessionStore keeps sessions in a MongoDB collection.
+// A TTL index on expiresAt lets MongoDB remove expired sessions by itself.
+type MongoSessionStore struct {
+	collection *mongo.Collection
+}
+
+type mongoSession struct {
+	ID        string      `bson:"_id"`
+	Data      SessionData `bson:",inline"`
+	ExpiresAt time.Time   `bson:"expiresAt"`
+}
+
+// NewMongoSessionStore stores sessions in mydb.mycollection and creates the TTL index.
+// Values come back as the types the BSON decoder picks, e.g. int32 and primitive.D.
+// example usage: store, err := ez.NewMongoSessionStore(client, "mydb", "sessions")
+func NewMongoSessionStore(client *mongo.Client, mydb string, mycollection string) (*MongoSessionStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	collection := client.Database(mydb).Collection(mycollection)
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session TTL index: %w", err)
+	}
+	return &MongoSessionStore{collection: collection}, nil
+}
+
+func (s *MongoSessionStore) Load(ctx context.Context, id string) (SessionData, bool, error) {
+	var doc mongoSession
+	// the TTL monitor only runs once a minute, so check the expiry as well
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: time.Now()}}}}
+	err := s.collection.FindOne(ctx, filter).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return SessionData{}, false, nil
+	}
+	if err != nil {
+		return SessionData{}, false, fmt.Errorf("failed to load session: %w", err)
+	}
+	return doc.Data, true, nil
+}
+
+func (s *MongoSessionStore) Save(ctx context.Context, id string, data SessionData, ttl time.Duration) error {
+	doc := mongoSession{ID: id, Data: data, ExpiresAt: time.Now().Add(ttl)}
+	_, err := s.collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: id}}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoSessionStore) Touch(ctx context.Context, id string, ttl time.Duration) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "expiresAt", Value: time.Now().Add(ttl)}}}}
+	if _, err := s.collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update); err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoSessionStore) Delete(ctx context.Context, id string) error {
+	if _, err := s.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}}); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// SessionManager loads and saves sessions for net/http handlers.
+// The cookie only holds a random ID signed with HMAC-SHA256, the data stays in the store.
+type SessionManager struct {
+	secret     []byte
+	store      SessionStore
+	ttl        time.Duration
+	cookieName string
+	secure     *bool
+	onError    func(r *http.Request, err error)
+}
+
+// SessionOption configures a SessionManager
+type SessionOption func(*SessionManager)
+
+// WithSessionStore replaces the default MemorySessionStore.
+// example usage: sm, err := ez.NewSessionManager(secret, ez.WithSessionStore(mongoStore))
+func WithSessionStore(store SessionStore) SessionOption {
+	return func(sm *SessionManager) {
+		sm.store = store
+	}
+}
+
+// WithSessionTTL sets how long an unused session lives, 24 hours by default.
+// Every request with the session starts the window again.
+// example usage: sm, err := ez.NewSessionManager(secret, ez.WithSessionTTL(30*time.Minute))
+func WithSessionTTL(ttl time.Duration) SessionOption {
+	return func(sm *SessionManager) {
+		sm.ttl = ttl
+	}
+}
+
+// WithSessionCookie sets the cookie name and whether it is Secure.
+// By default the cookie is called ez_session and is Secure on TLS requests.
+// example usage: sm, err := ez.NewSessionManager(secret, ez.WithSessionCookie("sid", true))
+func WithSessionCookie(name string, secure bool) SessionOption {
+	return func(sm *SessionManager) {
+		sm.cookieName = name
+		sm.secure = &secure
+	}
+}
+
+// WithSessionErrorHandler is called when the store fails to load or save a session.
+// By default errors are written to the standard logger and the request goes on with an empty session.
+// example usage: sm, err := ez.NewSessionManager(secret, ez.WithSessionErrorHandler(func(r *http.Request, err error) { log.Println(err) }))
+func WithSessionErrorHandler(fn func(r *http.Request, err error)) SessionOption {
+	return func(sm *SessionManager) {
+		sm.onError = fn
+	}
+}
+
+// NewSessionManager creates a session manager signing cookies with secret.
+// secret must be at least 32 random bytes, keep it stable across restarts.
+// example usage: sm, err := ez.NewSessionManager([]byte(os.Getenv("SESSION_SECRET")))
+func NewSessionManager(secret []byte, opts ...SessionOption) (*SessionManager, error) {
+	if len(secret) < minSessionSecret {
+		return nil, fmt.Errorf("failed to create session manager: secret is %d bytes, need at least %d", len(secret), minSessionSecret)
+	}
+	sm := &SessionManager{
+		secret:     slices.Clone(secret),
+		ttl:        24 * time.Hour,
+		cookieName: "ez_session",
+		onError: func(r *http.Request, err error) {
+			log.Printf("session error on %s %s: %v", r.Method, r.URL.Path, err)
+		},
+	}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	if sm.store == nil {
+		sm.store = NewMemorySessionStore()
+	}
+	return sm, nil
+}
+
+// minSessionSecret is the shortest secret NewSessionManager accepts.
+const minSessionSecret = 32
+
+// Session is the session of one request, it is safe for concurrent use
+type Session struct {
+	mu        sync.Mutex
+	id        string
+	data      SessionData
+	isNew     bool
+	dirty     bool
+	destroyed bool
+	oldIDs    []string
+}
+
+// ID returns the session ID
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// Get returns a value stored in the session.
+// example usage: userID, ok := sess.Get("user_id")
+func (s *Session) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data.Values[key]
+	return v, ok
+}
+
+// Set stores a value in the session.
+// example usage: sess.Set("user_id", 42)
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Values == nil {
+		s.data.Values = make(map[string]interface{})
+	}
+	s.data.Values[key] = value
+	s.dirty = true
+}
+
+// Delete removes a value from the session.
+// example usage: sess.Delete("cart")
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Values[key]; ok {
+		delete(s.data.Values, key)
+		s.dirty = true
+	}
+}
+
+// AddFlash queues a message for the next Flashes call, usually on the next page.
+// example usage: sess.AddFlash("Profile saved")
+func (s *Session) AddFlash(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Flashes = append(s.data.Flashes, msg)
+	s.dirty = true
+}
+
+// Flashes returns the queued flash messages and clears them.
+// example usage: for _, msg := range sess.Flashes() { fmt.Fprintln(w, msg) }
+func (s *Session) Flashes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flashes := s.data.Flashes
+	if len(flashes) > 0 {
+		s.data.Flashes = nil
+		s.dirty = true
+	}
+	return flashes
+}
+
+// Regenerate moves the session to a new ID and drops the old one.
+// Call it on login and privilege changes to prevent session fixation.
+// example usage: sess.Regenerate(); sess.Set("user_id", user.ID)
+func (s *Session) Regenerate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isNew {
+		s.oldIDs = append(s.oldIDs, s.id)
+	}
+	s.id = newSessionID()
+	s.isNew = true
+	s.dirty = true
+}
+
+// Destroy deletes the session from the store and clears the cookie, on logout for example.
+// example usage: sess.Destroy()
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.destroyed = true
+	s.data = SessionData{}
+}
+
+type sessionCtxKey struct{ sm *SessionManager }
+
+// Session returns the session of a request passing through Middleware, nil otherwise.
+// example usage: sess := sm.Session(r)
+func (sm *SessionManager) Session(r *http.Request) *Session {
+	sess, _ := r.Context().Value(sessionCtxKey{sm}).(*Session)
+	return sess
+}
+
+// Middleware loads the session before next runs and saves it before the response
+// headers are written. New sessions that were never written to get no cookie.
+// example usage: http.ListenAndServe(":8080", sm.Middleware(mux))
+func (sm *SessionManager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := sm.load(r)
+		r = r.WithContext(context.WithValue(r.Context(), sessionCtxKey{sm}, sess))
+		sw := &sessionWriter{ResponseWriter: w}
+		sw.commit = func() { sm.commit(w, r, sess) }
+		next.ServeHTTP(sw, r)
+		sw.save()
+	})
+}
+
+func (sm *SessionManager) load(r *http.Request) *Session {
+	if c, err := r.Cookie(sm.cookieName); err == nil {
+		if id, ok := sm.verify(c.Value); ok {
+			data, found, err := sm.store.Load(r.Context(), id)
+			if err != nil {
+				sm.onError(r, err)
+			} else if found {
+				data.Values = maps.Clone(data.Values)
+				data.Flashes = slices.Clone(data.Flashes)
+				return &Session{id: id, data: data}
+			}
+		}
+	}
+	return &Session{id: newSessionID(), isNew: true}
+}
+
+func (sm *SessionManager) commit(w http.ResponseWriter, r *http.Request, sess *Session) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	ctx := r.Context()
+	for _, id := range sess.oldIDs {
+		if err := sm.store.Delete(ctx, id); err != nil {
+			sm.onError(r, err)
+		}
+	}
+	sess.oldIDs = nil
+
+	if sess.destroyed {
+		if !sess.isNew {
+			if err := sm.store.Delete(ctx, sess.id); err != nil {
+				sm.onError(r, err)
+			}
+		}
+		http.SetCookie(w, sm.cookie(r, "", -1))
+		return
+	}
+	if sess.isNew && !sess.dirty {
+		return
+	}
+
+	var err error
+	if sess.dirty {
+		err = sm.store.Save(ctx, sess.id, sess.data, sm.ttl)
+	} else {
+		err = sm.store.Touch(ctx, sess.id, sm.ttl)
+	}
+	if err != nil {
+		sm.onError(r, err)
+		return
+	}
+	sess.isNew, sess.dirty = false, false
+	http.SetCookie(w, sm.cookie(r, sm.sign(sess.id), int(sm.ttl/time.Second)))
+}
+
+func (sm *SessionManager) cookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	secure := r.TLS != nil
+	if sm.secure != nil {
+		secure = *sm.secure
+	}
+	return &http.Cookie{
+		Name:     sm.cookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// sign returns the cookie value id.mac, the mac is base64url HMAC-SHA256 of the id.
+func (sm *SessionManager) sign(id string) string {
+	mac := hmac.New(sha256.New, sm.secret)
+	mac.Write([]byte(id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (sm *SessionManager) verify(value string) (string, bool) {
+	id, _, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(sm.sign(id)), []byte(value)) {
+		return "", false
+	}
+	return id, true
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("failed to read random session ID: %w", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sessionWriter saves the session right before the first header or body write,
+// because cookies cannot be set after that.
+type sessionWriter struct {
+	http.ResponseWriter
+	commit    func()
+	committed bool
+}
+
+func (w *sessionWriter) save() {
+	if !w.committed {
+		w.committed = true
+		w.commit()
+	}
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.save()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.save()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the headers, so the session is saved first, then flushes the
+// underlying writer for streaming handlers that assert http.Flusher.
+func (w *sessionWriter) Flush() {
+	w.save()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
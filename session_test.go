@@ -0,0 +1,39 @@
+package ez
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionWriterForwardsFlush(t *testing.T) {
+	sm, err := NewSessionManager([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sm.Session(r).Set("user", "42")
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("session writer does not implement http.Flusher")
+		}
+		f.Flush()
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !rec.Flushed {
+		t.Fatal("Flush did not reach the underlying writer")
+	}
+	if len(rec.Result().Cookies()) == 0 {
+		t.Fatal("session cookie missing, Flush sent headers before saving the session")
+	}
+}
+
+func TestSessionManagerRefusesShortSecret(t *testing.T) {
+	for _, secret := range [][]byte{nil, []byte("short")} {
+		if _, err := NewSessionManager(secret); err == nil {
+			t.Fatalf("NewSessionManager accepted a %d byte secret", len(secret))
+		}
+	}
+}
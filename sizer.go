@@ -0,0 +1,123 @@
+package ez
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Sizer lets a value report how many bytes it holds, for SafeMaps bounded with WithMaxBytes
+type Sizer interface {
+	Size() int64
+}
+
+// entryOverhead roughly covers the entry struct and its map slot
+const entryOverhead = int64(unsafe.Sizeof(entry[struct{}]{})) + 48
+
+func estimateEntrySize(key, value any) int64 {
+	return entryOverhead + EstimateSize(key) + EstimateSize(value)
+}
+
+// EstimateSize guesses how many bytes v holds, following pointers, slices, maps and strings.
+// Values implementing Sizer are trusted. Shared pointers are only counted once.
+// example usage: n := ez.EstimateSize(myStruct)
+func EstimateSize(v any) int64 {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case Sizer:
+		return x.Size()
+	case string:
+		return int64(len(x)) + int64(unsafe.Sizeof(x))
+	case []byte:
+		return int64(cap(x)) + int64(unsafe.Sizeof(x))
+	}
+	rv := reflect.ValueOf(v)
+	return int64(rv.Type().Size()) + indirectSize(rv, make(map[uintptr]bool))
+}
+
+// indirectSize counts the memory v points to, not v itself.
+func indirectSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return int64(v.Type().Elem().Size()) + indirectSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		if elem.Kind() == reflect.Pointer {
+			return indirectSize(elem, seen)
+		}
+		return int64(elem.Type().Size()) + indirectSize(elem, seen)
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		n := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			n += indirectSize(v.Index(i), seen)
+		}
+		return n
+	case reflect.Array:
+		var n int64
+		for i := 0; i < v.Len(); i++ {
+			n += indirectSize(v.Index(i), seen)
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		n := int64(v.Len()) * int64(v.Type().Key().Size()+v.Type().Elem().Size())
+		iter := v.MapRange()
+		for iter.Next() {
+			n += indirectSize(iter.Key(), seen) + indirectSize(iter.Value(), seen)
+		}
+		return n
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += indirectSize(v.Field(i), seen)
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+func (m *SafeMapOf[K, V]) addBytes(s *shard[K, V], n int64) {
+	if n == 0 {
+		return
+	}
+	s.bytes += n
+	m.bytes.Add(n)
+}
+
+// shrinkLocked evicts entries until the shard is back under its byte budget,
+// keep is never evicted so a grown value stays in even when it is the only candidate.
+func (m *SafeMapOf[K, V]) shrinkLocked(s *shard[K, V], keep K, evs []eviction[K, V]) []eviction[K, V] {
+	for s.policy != nil && s.maxBytes > 0 && s.bytes > s.maxBytes {
+		vk, ok := s.policy.victim()
+		if !ok || vk == keep {
+			break
+		}
+		victim := m.removeLocked(s, vk)
+		evs = append(evs, eviction[K, V]{vk, victim.value, ReasonCapacity})
+	}
+	return evs
+}
+
+// Bytes returns the estimated memory held by the entries.
+// It is only tracked on maps created with WithMaxBytes, otherwise it is 0.
+// example usage: fmt.Println(m.Bytes() >> 20, "MB")
+func (m *SafeMapOf[K, V]) Bytes() int64 {
+	return m.bytes.Load()
+}
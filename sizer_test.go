@@ -0,0 +1,95 @@
+package ez
+
+import (
+	"strings"
+	"testing"
+)
+
+type fixedSize int64
+
+func (f fixedSize) Size() int64 { return int64(f) }
+
+func TestMaxBytesEvictsToBudget(t *testing.T) {
+	m := NewSafeMapOf[string, []byte](4, WithMaxBytes(40000), WithQuiet())
+	defer m.Close()
+	for i := 0; i < 1000; i++ {
+		m.Insert("key"+strings.Repeat("x", i%7)+string(rune('a'+i%26))+string(rune(i)), 0, make([]byte, 1000))
+	}
+	if m.Bytes() > 40000 {
+		t.Fatalf("Bytes() = %d, want at most 40000", m.Bytes())
+	}
+	if m.Len() == 0 {
+		t.Fatal("map is empty, want entries under the budget")
+	}
+	m.Clear()
+	if m.Bytes() != 0 {
+		t.Fatalf("Bytes() after Clear = %d, want 0", m.Bytes())
+	}
+}
+
+func TestMaxBytesTracksReplaceAndDelete(t *testing.T) {
+	m := NewSafeMapOf[string, any](1, WithMaxBytes(1000), WithSizer(func(key, value any) int64 {
+		return value.(Sizer).Size()
+	}), WithQuiet())
+	defer m.Close()
+	m.Insert("a", 0, fixedSize(100))
+	m.Insert("a", 0, fixedSize(300))
+	if got := m.Bytes(); got != 300 {
+		t.Fatalf("Bytes() after replace = %d, want 300", got)
+	}
+	m.Update("a", func(old any, ok bool) (any, bool) { return fixedSize(50), true })
+	if got := m.Bytes(); got != 50 {
+		t.Fatalf("Bytes() after Update = %d, want 50", got)
+	}
+	m.Delete("a")
+	if got := m.Bytes(); got != 0 {
+		t.Fatalf("Bytes() after Delete = %d, want 0", got)
+	}
+}
+
+func TestMaxBytesOverBudgetOverwrite(t *testing.T) {
+	for _, name := range []string{"Insert", "Update"} {
+		t.Run(name, func(t *testing.T) {
+			m := NewSafeMap(1, WithMaxBytes(4096), WithQuiet())
+			defer m.Close()
+			var reasons []EvictReason
+			m.OnEvict(func(key string, value any, reason EvictReason) {
+				reasons = append(reasons, reason)
+			})
+			m.Insert("k", 0, "old")
+			big := strings.Repeat("x", 10<<10)
+			if name == "Insert" {
+				m.Insert("k", 0, big)
+			} else {
+				m.Update("k", func(old any, ok bool) (any, bool) { return big, true })
+			}
+			if v, ok := m.Get("k"); ok {
+				t.Fatalf("Get after over budget write = %v, want missing", v)
+			}
+			if len(reasons) != 1 || reasons[0] != ReasonCapacity {
+				t.Fatalf("evict reasons = %v, want [capacity]", reasons)
+			}
+			if m.Bytes() != 0 || m.Len() != 0 {
+				t.Fatalf("Bytes() = %d, Len() = %d, want 0, 0", m.Bytes(), m.Len())
+			}
+		})
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+	}
+	n := &node{Name: "abc"}
+	n.Next = n
+	if got := EstimateSize(n); got <= 0 {
+		t.Fatalf("EstimateSize(cycle) = %d, want > 0", got)
+	}
+	if got := EstimateSize(fixedSize(42)); got != 42 {
+		t.Fatalf("EstimateSize(Sizer) = %d, want 42", got)
+	}
+	if small, large := EstimateSize(make([]byte, 10)), EstimateSize(make([]byte, 1000)); large-small != 990 {
+		t.Fatalf("EstimateSize byte slices differ by %d, want 990", large-small)
+	}
+}
@@ -0,0 +1,275 @@
+package ez
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotFormat selects the encoding used by SaveTo and LoadFrom
+type SnapshotFormat int
+
+const (
+	// SnapshotGob is compact and keeps Go types, custom types stored in interface{} values need gob.Register
+	SnapshotGob SnapshotFormat = iota
+	// SnapshotJSON is human readable, values are stored as raw JSON.
+	// It is lossy for interface{} values: numbers come back as float64, structs as map[string]interface{}
+	// and []byte as a base64 string. Use a concrete value type, gob or SetValueCodec to keep types.
+	SnapshotJSON
+)
+
+const snapshotVersion = 1
+
+// ValueCodec turns SafeMap values into bytes and back for snapshots.
+// Set one with SetValueCodec when the default gob or JSON encoding does not fit the value type.
+type ValueCodec[V any] interface {
+	Marshal(value V) ([]byte, error)
+	Unmarshal(data []byte) (V, error)
+}
+
+// GobCodec encodes values with encoding/gob
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) Marshal(value V) ([]byte, error) {
+	var buf bytes.Buffer
+	// wrap so interface{} values keep their concrete type
+	err := gob.NewEncoder(&buf).Encode(struct{ V V }{value})
+	return buf.Bytes(), err
+}
+
+func (GobCodec[V]) Unmarshal(data []byte) (V, error) {
+	var w struct{ V V }
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&w)
+	return w.V, err
+}
+
+// JSONCodec encodes values with encoding/json.
+// Values decode into V, so for interface{} the types are the ones encoding/json picks (float64, map, slice, string, bool).
+type JSONCodec[V any] struct{}
+
+func (JSONCodec[V]) Marshal(value V) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONCodec[V]) Unmarshal(data []byte) (V, error) {
+	var v V
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+type snapshotRecord[K comparable] struct {
+	Key     K             `json:"key"`
+	Value   []byte        `json:"-"`
+	TTL     time.Duration `json:"ttl"`
+	Sliding time.Duration `json:"sliding,omitempty"`
+	Counter uint32        `json:"counter"`
+	Tags    []string      `json:"tags,omitempty"`
+}
+
+type jsonSnapshotRecord[K comparable] struct {
+	snapshotRecord[K]
+	Value json.RawMessage `json:"value"`
+}
+
+type snapshotFile[K comparable] struct {
+	Version int                 `json:"version"`
+	Entries []snapshotRecord[K] `json:"-"`
+}
+
+type jsonSnapshotFile[K comparable] struct {
+	Version int                     `json:"version"`
+	Entries []jsonSnapshotRecord[K] `json:"entries"`
+}
+
+// SetValueCodec replaces the codec used for values in snapshots.
+// example usage: m.SetValueCodec(myProtoCodec{})
+func (m *SafeMapOf[K, V]) SetValueCodec(codec ValueCodec[V]) {
+	m.mu.Lock()
+	m.codec = codec
+	m.mu.Unlock()
+}
+
+func (m *SafeMapOf[K, V]) valueCodec(format SnapshotFormat) ValueCodec[V] {
+	m.mu.RLock()
+	codec := m.codec
+	m.mu.RUnlock()
+	if codec != nil {
+		return codec
+	}
+	if format == SnapshotJSON {
+		return JSONCodec[V]{}
+	}
+	return GobCodec[V]{}
+}
+
+func snapshotFormatArg(args []SnapshotFormat) SnapshotFormat {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return SnapshotGob
+}
+
+// SaveTo writes every live entry with its remaining TTL and access counter to w.
+// Expired entries are skipped. The optional argument picks the format, gob is the default.
+// example usage: err := m.SaveTo(w, ez.SnapshotJSON)
+func (m *SafeMapOf[K, V]) SaveTo(w io.Writer, format ...SnapshotFormat) error {
+	f := snapshotFormatArg(format)
+	codec := m.valueCodec(f)
+	now := m.now()
+
+	snap := snapshotFile[K]{Version: snapshotVersion}
+	for _, s := range m.shards {
+		s.mu.Lock()
+		type live struct {
+			key     K
+			value   V
+			ttl     time.Duration
+			sliding time.Duration
+			counter uint32
+			tags    []string
+		}
+		entries := make([]live, 0, len(s.items))
+		for key, e := range s.items {
+			var ttl time.Duration
+			if !e.expire.IsZero() {
+				ttl = e.expire.Sub(now)
+				if ttl <= 0 {
+					continue
+				}
+			}
+			entries = append(entries, live{key, e.value, ttl, e.sliding, e.getcounter.Load(), e.tags})
+		}
+		s.mu.Unlock()
+
+		for _, l := range entries {
+			b, err := codec.Marshal(l.value)
+			if err != nil {
+				return fmt.Errorf("failed to encode value for key %v: %w", l.key, err)
+			}
+			snap.Entries = append(snap.Entries, snapshotRecord[K]{Key: l.key, Value: b, TTL: l.ttl, Sliding: l.sliding, Counter: l.counter, Tags: l.tags})
+		}
+	}
+
+	switch f {
+	case SnapshotJSON:
+		out := jsonSnapshotFile[K]{Version: snap.Version, Entries: make([]jsonSnapshotRecord[K], len(snap.Entries))}
+		for i, r := range snap.Entries {
+			if !json.Valid(r.Value) {
+				return fmt.Errorf("codec output for key %v is not valid JSON", r.Key)
+			}
+			out.Entries[i] = jsonSnapshotRecord[K]{snapshotRecord: r, Value: r.Value}
+		}
+		if err := json.NewEncoder(w).Encode(out); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	case SnapshotGob:
+		enc := gob.NewEncoder(w)
+		if err := enc.Encode(snap.Version); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+		if err := enc.Encode(snap.Entries); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown snapshot format %d", f)
+	}
+	return nil
+}
+
+// LoadFrom reads a snapshot written by SaveTo and inserts its entries.
+// TTLs restart from the moment of loading, existing keys are overwritten.
+// Sliding entries get the time they had left when saved and keep sliding with their window.
+// example usage: err := m.LoadFrom(r, ez.SnapshotJSON)
+func (m *SafeMapOf[K, V]) LoadFrom(r io.Reader, format ...SnapshotFormat) error {
+	f := snapshotFormatArg(format)
+	codec := m.valueCodec(f)
+
+	var version int
+	var records []snapshotRecord[K]
+	switch f {
+	case SnapshotJSON:
+		var in jsonSnapshotFile[K]
+		if err := json.NewDecoder(r).Decode(&in); err != nil {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		version = in.Version
+		records = make([]snapshotRecord[K], len(in.Entries))
+		for i, jr := range in.Entries {
+			records[i] = jr.snapshotRecord
+			records[i].Value = jr.Value
+		}
+	case SnapshotGob:
+		dec := gob.NewDecoder(r)
+		if err := dec.Decode(&version); err != nil {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if err := dec.Decode(&records); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown snapshot format %d", f)
+	}
+	if version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	for _, rec := range records {
+		value, err := codec.Unmarshal(rec.Value)
+		if err != nil {
+			return fmt.Errorf("failed to decode value for key %v: %w", rec.Key, err)
+		}
+		if rec.Sliding > 0 {
+			key := copyKey(rec.Key)
+			e := m.newEntry(copyValue(value), rec.TTL, rec.Counter)
+			e.sliding = rec.Sliding
+			e.tags = copyTags(rec.Tags)
+			m.insertEntry(key, e)
+			continue
+		}
+		m.InsertWithTTL(rec.Key, rec.TTL, rec.Counter, value, rec.Tags...)
+	}
+	return nil
+}
+
+// SaveFile writes a snapshot to path, the file is replaced atomically.
+// example usage: err := m.SaveFile("cache.snap")
+func (m *SafeMapOf[K, V]) SaveFile(path string, format ...SnapshotFormat) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := m.SaveTo(tmp, format...); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot file: %w", err)
+	}
+	return nil
+}
+
+// LoadFile restores a snapshot written by SaveFile.
+// example usage: err := m.LoadFile("cache.snap")
+func (m *SafeMapOf[K, V]) LoadFile(path string, format ...SnapshotFormat) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot file: %w", err)
+	}
+	defer file.Close()
+	return m.LoadFrom(file, format...)
+}
@@ -0,0 +1,54 @@
+package ez
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSnapshotKeepsSlidingTTL(t *testing.T) {
+	for _, f := range []SnapshotFormat{SnapshotGob, SnapshotJSON} {
+		clock := &fakeClock{now: time.Unix(1000, 0)}
+		m := NewSafeMap(2, WithQuiet(), WithClock(clock.Now), WithJanitorInterval(0))
+		m.InsertSliding("s", time.Minute, 0, "v")
+		clock.Add(40 * time.Second)
+		var buf bytes.Buffer
+		if err := m.SaveTo(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+		m.Close()
+
+		m = NewSafeMap(2, WithQuiet(), WithClock(clock.Now), WithJanitorInterval(0))
+		if err := m.LoadFrom(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+		if left, ok := m.TTL("s"); !ok || left != 20*time.Second {
+			t.Fatalf("format %d: TTL after load = %v, %v, want the 20s that were left", f, left, ok)
+		}
+		for i, step := range []time.Duration{15, 50, 50, 50} {
+			clock.Add(step * time.Second)
+			if _, ok := m.Get("s"); !ok {
+				t.Fatalf("format %d: sliding entry expired at read %d", f, i)
+			}
+		}
+		m.Close()
+	}
+}
+
+func TestSnapshotJSONNumbersAreFloat64(t *testing.T) {
+	m := NewSafeMap(1, WithQuiet())
+	defer m.Close()
+	m.Insert("n", 0, 42)
+	var buf bytes.Buffer
+	if err := m.SaveTo(&buf, SnapshotJSON); err != nil {
+		t.Fatal(err)
+	}
+	m.Clear()
+	if err := m.LoadFrom(&buf, SnapshotJSON); err != nil {
+		t.Fatal(err)
+	}
+	// documented loss: interface{} values take the types encoding/json picks
+	if v, _ := m.Get("n"); v != float64(42) {
+		t.Fatalf("Get(n) = %#v, want float64(42)", v)
+	}
+}
@@ -0,0 +1,123 @@
+package ez
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+type mapStats struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	inserts     atomic.Uint64
+	deletes     atomic.Uint64
+	expirations atomic.Uint64
+	exhaustions atomic.Uint64
+	evictions   atomic.Uint64
+}
+
+func (s *mapStats) record(reason EvictReason) {
+	switch reason {
+	case ReasonDeleted, ReasonCleared, ReasonInvalidated:
+		s.deletes.Add(1)
+	case ReasonExpired:
+		s.expirations.Add(1)
+	case ReasonExhausted:
+		s.exhaustions.Add(1)
+	case ReasonCapacity:
+		s.evictions.Add(1)
+	}
+}
+
+// Stats is a point in time copy of the SafeMap counters
+type Stats struct {
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Inserts     uint64 `json:"inserts"`
+	Deletes     uint64 `json:"deletes"`
+	Expirations uint64 `json:"expirations"`
+	Exhaustions uint64 `json:"exhaustions"`
+	Evictions   uint64 `json:"evictions"`
+}
+
+// HitRatio returns hits / (hits + misses), 0 when Get was never called
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// Stats returns a snapshot of the SafeMap counters.
+// Hits and misses count Get calls, a Get that uses up the access counter is a miss.
+// example usage: fmt.Println(m.Stats().HitRatio())
+func (m *SafeMapOf[K, V]) Stats() Stats {
+	return Stats{
+		Entries:     m.Len(),
+		Bytes:       m.Bytes(),
+		Hits:        m.stats.hits.Load(),
+		Misses:      m.stats.misses.Load(),
+		Inserts:     m.stats.inserts.Load(),
+		Deletes:     m.stats.deletes.Load(),
+		Expirations: m.stats.expirations.Load(),
+		Exhaustions: m.stats.exhaustions.Load(),
+		Evictions:   m.stats.evictions.Load(),
+	}
+}
+
+// PublishExpvar exposes the SafeMap stats under name in expvar (/debug/vars).
+// Like expvar.Publish it panics if the name is already taken.
+// example usage: m.PublishExpvar("sessions")
+func (m *SafeMapOf[K, V]) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return m.Stats()
+	}))
+}
+
+// WritePrometheus writes the SafeMap stats in the Prometheus text format,
+// every series carries a map label with the given name.
+// example usage: err := m.WritePrometheus(w, "sessions")
+func (m *SafeMapOf[K, V]) WritePrometheus(w io.Writer, name string) error {
+	st := m.Stats()
+	label := fmt.Sprintf("{map=%q}", name)
+	metrics := []struct {
+		name  string
+		kind  string
+		help  string
+		value uint64
+	}{
+		{"ez_safemap_entries", "gauge", "Number of entries in the map.", uint64(st.Entries)},
+		{"ez_safemap_bytes", "gauge", "Estimated bytes held by the entries, only tracked with a byte budget.", uint64(st.Bytes)},
+		{"ez_safemap_hits_total", "counter", "Get calls that found a live entry.", st.Hits},
+		{"ez_safemap_misses_total", "counter", "Get calls that found nothing.", st.Misses},
+		{"ez_safemap_inserts_total", "counter", "Values stored in the map.", st.Inserts},
+		{"ez_safemap_deletes_total", "counter", "Entries removed by Delete, Clear or InvalidateTag.", st.Deletes},
+		{"ez_safemap_expirations_total", "counter", "Entries removed because their TTL ran out.", st.Expirations},
+		{"ez_safemap_exhaustions_total", "counter", "Entries removed because their access counter reached zero.", st.Exhaustions},
+		{"ez_safemap_evictions_total", "counter", "Entries evicted to stay under the size limit.", st.Evictions},
+	}
+
+	var buf bytes.Buffer
+	for _, mt := range metrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", mt.name, mt.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", mt.name, mt.kind)
+		fmt.Fprintf(&buf, "%s%s %d\n", mt.name, label, mt.value)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// MetricsHandler serves the SafeMap stats for a Prometheus scraper.
+// example usage: http.Handle("/metrics", m.MetricsHandler("sessions"))
+func (m *SafeMapOf[K, V]) MetricsHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w, name)
+	})
+}
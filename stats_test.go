@@ -0,0 +1,62 @@
+package ez
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsCounters(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := NewSafeMapOf[string, int](1, WithMaxEntries(3, EvictLRU), WithClock(clock.Now), WithJanitorInterval(0), WithQuiet())
+	defer m.Close()
+
+	m.Insert("a", 0, 1)
+	m.Insert("used", 2, 2)
+	m.InsertWithTTL("short", time.Second, 0, 3)
+	m.Get("a")
+	m.Get("used")
+	m.Get("used")
+	m.Get("missing")
+	m.Delete("a")
+	clock.Add(2 * time.Second)
+	m.CleanExpired()
+	for _, key := range []string{"x", "y", "z", "w"} {
+		m.Insert(key, 0, 0)
+	}
+
+	want := Stats{Entries: 3, Hits: 2, Misses: 2, Inserts: 7, Deletes: 1, Expirations: 1, Exhaustions: 1, Evictions: 1}
+	if got := m.Stats(); got != want {
+		t.Fatalf("Stats() = %+v, want %+v", got, want)
+	}
+	if r := m.Stats().HitRatio(); r != 0.5 {
+		t.Fatalf("HitRatio() = %v, want 0.5", r)
+	}
+	if r := (Stats{}).HitRatio(); r != 0 {
+		t.Fatalf("HitRatio() without Gets = %v, want 0", r)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	m := NewSafeMapOf[string, int](1, WithQuiet())
+	defer m.Close()
+	m.Insert("a", 0, 1)
+	m.Get("a")
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf, "users"); err != nil {
+		t.Fatalf("WritePrometheus: %v", err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE ez_safemap_hits_total counter\n",
+		`ez_safemap_entries{map="users"} 1` + "\n",
+		`ez_safemap_hits_total{map="users"} 1` + "\n",
+		`ez_safemap_misses_total{map="users"} 0` + "\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Fatalf("WritePrometheus output is missing %q:\n%s", line, out)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package ez
+
+import "slices"
+
+func copyTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = copyString(t)
+	}
+	return out
+}
+
+// tag and untag keep the tag index in sync, they run under the shard lock of key.
+func (m *SafeMapOf[K, V]) tag(key K, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	m.tagMu.Lock()
+	if m.tags == nil {
+		m.tags = make(map[string]map[K]struct{})
+	}
+	for _, t := range tags {
+		keys := m.tags[t]
+		if keys == nil {
+			keys = make(map[K]struct{})
+			m.tags[t] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	m.tagMu.Unlock()
+}
+
+func (m *SafeMapOf[K, V]) untag(key K, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	m.tagMu.Lock()
+	for _, t := range tags {
+		if keys := m.tags[t]; keys != nil {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(m.tags, t)
+			}
+		}
+	}
+	m.tagMu.Unlock()
+}
+
+// InvalidateTag removes every entry inserted with tag, across all shards, and returns how many went.
+// OnEvict hooks see ReasonInvalidated.
+// example usage: n := m.InvalidateTag("user:42")
+func (m *SafeMapOf[K, V]) InvalidateTag(tag string) int {
+	m.tagMu.Lock()
+	keys := make([]K, 0, len(m.tags[tag]))
+	for key := range m.tags[tag] {
+		keys = append(keys, key)
+	}
+	m.tagMu.Unlock()
+
+	removed := 0
+	for _, key := range keys {
+		s := m.shards[m.getShardIndex(key)]
+		s.mu.Lock()
+		e, ok := s.items[key]
+		// the key may have been replaced by an untagged value since the index was read
+		if !ok || !slices.Contains(e.tags, tag) {
+			s.mu.Unlock()
+			continue
+		}
+		m.removeLocked(s, key)
+		m.publishEviction(key, e.value, ReasonInvalidated)
+		s.mu.Unlock()
+		removed++
+		m.notifyEvict(key, e.value, ReasonInvalidated)
+	}
+	return removed
+}
+
+// Tags returns the tags key was inserted with.
+// example usage: tags := m.Tags("profile:42")
+func (m *SafeMapOf[K, V]) Tags(key K) []string {
+	s := m.shards[m.getShardIndex(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		return slices.Clone(e.tags)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package ez
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	m := NewSafeMapOf[string, int](4, WithQuiet())
+	defer m.Close()
+	invalidated := 0
+	m.OnEvict(func(key string, value int, reason EvictReason) {
+		if reason == ReasonInvalidated {
+			invalidated++
+		}
+	})
+	for i := 0; i < 10; i++ {
+		m.Insert(fmt.Sprint("post:", i), 0, i, "user:1", fmt.Sprint("page:", i%2))
+	}
+	m.Insert("other", 0, 0, "user:2")
+	// replacing a value drops the tags it was inserted with
+	m.Insert("post:0", 0, 0)
+
+	if n := m.InvalidateTag("user:1"); n != 9 {
+		t.Fatalf("InvalidateTag(user:1) = %d, want 9", n)
+	}
+	if invalidated != 9 {
+		t.Fatalf("OnEvict saw %d invalidations, want 9", invalidated)
+	}
+	if m.Len() != 2 {
+		t.Fatalf("Len() = %d, want post:0 and other left", m.Len())
+	}
+	if tags := m.Tags("post:0"); len(tags) != 0 {
+		t.Fatalf("Tags(post:0) = %v after an untagged replace, want none", tags)
+	}
+	if n := m.InvalidateTag("page:1"); n != 0 {
+		t.Fatalf("InvalidateTag(page:1) = %d after its keys were removed, want 0", n)
+	}
+	if tags := m.Tags("other"); len(tags) != 1 || tags[0] != "user:2" {
+		t.Fatalf("Tags(other) = %v, want [user:2]", tags)
+	}
+}
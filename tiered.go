@@ -0,0 +1,148 @@
+package ez
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TieredCache keeps hot values in a local SafeMapOf (L1) in front of a MongoDB collection (L2)
+// shared by every instance. Values are stored in Mongo with the codec of the L1 map, gob by default.
+type TieredCache[V any] struct {
+	l1         *SafeMapOf[string, V]
+	client     *mongo.Client
+	mydb       string
+	collection string
+	l1TTL      time.Duration
+}
+
+// TieredOption configures a TieredCache
+type TieredOption func(*tieredConfig)
+
+type tieredConfig struct {
+	l1TTL time.Duration
+}
+
+// WithL1TTL caps how long a value stays in the local tier, so changes made by other
+// instances show up after at most d. By default L1 keeps the full L2 TTL.
+// example usage: c, err := ez.NewTieredCache(m, client, "mydb", "cache", ez.WithL1TTL(30*time.Second))
+func WithL1TTL(d time.Duration) TieredOption {
+	return func(c *tieredConfig) {
+		c.l1TTL = d
+	}
+}
+
+// NewTieredCache puts l1 in front of mydb.mycollection and creates the TTL index on expiresAt.
+// example usage: c, err := ez.NewTieredCache(ez.NewSafeMapOf[string, Report](16), client, "mydb", "reports")
+func NewTieredCache[V any](l1 *SafeMapOf[string, V], client *mongo.Client, mydb string, mycollection string, opts ...TieredOption) (*TieredCache[V], error) {
+	cfg := tieredConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	// expireAfterSeconds 0 makes MongoDB delete a document once expiresAt has passed
+	if err := Mongocreateindex(client, mydb, mycollection, "expiresAt", options.Index().SetExpireAfterSeconds(0)); err != nil {
+		return nil, fmt.Errorf("failed to create TTL index: %w", err)
+	}
+	return &TieredCache[V]{l1: l1, client: client, mydb: mydb, collection: mycollection, l1TTL: cfg.l1TTL}, nil
+}
+
+// Get returns the value for key from L1, or from L2 in which case it is copied into L1.
+// A miss in both tiers returns false and no error.
+// example usage: report, ok, err := c.Get("report:2024-05")
+func (c *TieredCache[V]) Get(key string) (V, bool, error) {
+	var zero V
+	if v, ok := c.l1.Get(key); ok {
+		return v, true, nil
+	}
+
+	now := time.Now()
+	filter := bson.D{
+		{Key: "_id", Value: key},
+		// the TTL monitor only runs once a minute, so skip expired documents it has not removed yet
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: now}}}},
+			bson.D{{Key: "expiresAt", Value: bson.D{{Key: "$exists", Value: false}}}},
+		}},
+	}
+	doc, err := Mongofind_one(c.client, c.mydb, c.collection, filter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return zero, false, nil
+	}
+	if err != nil {
+		return zero, false, fmt.Errorf("failed to find %s in L2: %w", key, err)
+	}
+
+	var data []byte
+	switch raw := doc["value"].(type) {
+	case primitive.Binary:
+		data = raw.Data
+	case []byte:
+		data = raw
+	default:
+		return zero, false, fmt.Errorf("unexpected L2 value type %T for %s", raw, key)
+	}
+	value, err := c.l1.valueCodec(SnapshotGob).Unmarshal(data)
+	if err != nil {
+		return zero, false, fmt.Errorf("failed to decode L2 value for %s: %w", key, err)
+	}
+
+	ttl := time.Duration(0)
+	if at, ok := doc["expiresAt"].(primitive.DateTime); ok {
+		if ttl = at.Time().Sub(now); ttl <= 0 {
+			return zero, false, nil
+		}
+	}
+	c.l1.InsertWithTTL(key, c.localTTL(ttl), 0, value)
+	return value, true, nil
+}
+
+// Set writes value to L2 and then to L1. A ttl of zero or less never expires.
+// example usage: err := c.Set("report:2024-05", report, time.Hour)
+func (c *TieredCache[V]) Set(key string, value V, ttl time.Duration) error {
+	data, err := c.l1.valueCodec(SnapshotGob).Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode value for %s: %w", key, err)
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "value", Value: data}}}}
+	if ttl > 0 {
+		update[0].Value = append(update[0].Value.(bson.D), bson.E{Key: "expiresAt", Value: time.Now().Add(ttl)})
+	} else {
+		update = append(update, bson.E{Key: "$unset", Value: bson.D{{Key: "expiresAt", Value: ""}}})
+	}
+	err = Mongoupdate_one(c.client, c.mydb, c.collection, bson.D{{Key: "_id", Value: key}}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to write %s to L2: %w", key, err)
+	}
+	c.l1.InsertWithTTL(key, c.localTTL(ttl), 0, value)
+	return nil
+}
+
+// Delete removes key from both tiers. Other instances keep their L1 copy until it expires.
+// example usage: err := c.Delete("report:2024-05")
+func (c *TieredCache[V]) Delete(key string) error {
+	// L2 goes first, a Get between the two steps would copy a still present L2 value back into L1
+	err := Mongodel_one(c.client, c.mydb, c.collection, bson.D{{Key: "_id", Value: key}})
+	c.l1.Delete(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from L2: %w", key, err)
+	}
+	return nil
+}
+
+// L1 returns the local SafeMapOf of the cache.
+func (c *TieredCache[V]) L1() *SafeMapOf[string, V] {
+	return c.l1
+}
+
+func (c *TieredCache[V]) localTTL(ttl time.Duration) time.Duration {
+	if c.l1TTL > 0 && (ttl <= 0 || ttl > c.l1TTL) {
+		return c.l1TTL
+	}
+	return ttl
+}
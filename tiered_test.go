@@ -0,0 +1,39 @@
+package ez
+
+import (
+	"testing"
+	"time"
+)
+
+// The L2 paths need a MongoDB server, these tests cover what runs without one.
+
+func TestTieredLocalTTL(t *testing.T) {
+	for _, tc := range []struct {
+		l1TTL, ttl, want time.Duration
+	}{
+		{0, 0, 0},
+		{0, time.Hour, time.Hour},
+		{time.Minute, 0, time.Minute},
+		{time.Minute, time.Hour, time.Minute},
+		{time.Minute, time.Second, time.Second},
+	} {
+		c := &TieredCache[int]{l1TTL: tc.l1TTL}
+		if got := c.localTTL(tc.ttl); got != tc.want {
+			t.Fatalf("localTTL(%v) with WithL1TTL(%v) = %v, want %v", tc.ttl, tc.l1TTL, got, tc.want)
+		}
+	}
+}
+
+func TestTieredGetServesL1(t *testing.T) {
+	l1 := NewSafeMapOf[string, int](4, WithQuiet())
+	defer l1.Close()
+	// no client, a Get that reached L2 would panic
+	c := &TieredCache[int]{l1: l1}
+	l1.Insert("k", 0, 7)
+	if v, ok, err := c.Get("k"); err != nil || !ok || v != 7 {
+		t.Fatalf("Get(k) = %d, %v, %v, want 7 from L1", v, ok, err)
+	}
+	if c.L1() != l1 {
+		t.Fatal("L1() does not return the local map")
+	}
+}
@@ -0,0 +1,612 @@
+package ez
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls how often the write-ahead log is flushed to disk with fsync
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs after every write, nothing acknowledged is lost on a crash
+	SyncAlways SyncPolicy = iota
+	// SyncEverySecond fsyncs once a second, a crash loses at most about a second of writes
+	SyncEverySecond
+	// SyncNever leaves flushing to the operating system
+	SyncNever
+)
+
+const (
+	walOpSet byte = iota + 1
+	walOpDelete
+	walOpBatch
+)
+
+// walCompactMinSize is the log size below which background compaction never runs.
+const walCompactMinSize = 1 << 20
+
+// walMaxRecord caps the payload of one record. Writes that need more are refused
+// and a header claiming more fails the replay instead of allocating it.
+const walMaxRecord = 64 << 20
+
+type walLog[K comparable, V any] struct {
+	mu       sync.Mutex
+	file     *os.File
+	path     string
+	policy   SyncPolicy
+	codec    ValueCodec[V]
+	size     int64
+	baseSize int64
+	dirty    bool
+	closed   bool
+	err      error
+
+	compacting bool
+	pending    [][]byte
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenSafeMap opens or creates a durable string keyed SafeMap backed by the log file at path.
+// example usage: m, err := ez.OpenSafeMap("flags.wal", 16, ez.SyncEverySecond)
+func OpenSafeMap(path string, size int, policy SyncPolicy, opts ...SafeMapOption) (*SafeMap, error) {
+	m := NewSafeMap(size, opts...)
+	if err := m.OpenWAL(path, policy); err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// OpenWAL makes the map durable: the log at path is replayed into the map,
+// then every insert, update and removal is appended to it.
+// The log is compacted in the background once it is more than twice its last compacted size.
+// Access counters and sliding expiry are restored as of the last write, reads are not logged.
+// A write the log cannot encode (an unregistered gob type, a tag over 64KB, a record over 64MB)
+// is refused and not stored, the reason is kept for WALErr.
+// Batch and MSet are logged as one record so a crash replays all of them or none,
+// batches over 64MB of log are split into several records.
+// Set a custom value codec with SetValueCodec before calling OpenWAL, and call it before the map is shared.
+// example usage: err := m.OpenWAL("cache.wal", ez.SyncAlways)
+func (m *SafeMapOf[K, V]) OpenWAL(path string, policy SyncPolicy) error {
+	if m.wal != nil {
+		return fmt.Errorf("write-ahead log already open at %s", m.wal.path)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+	w := &walLog[K, V]{
+		file:   file,
+		path:   path,
+		policy: policy,
+		codec:  m.valueCodec(SnapshotGob),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	good, err := m.replayWAL(w)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	// drop a torn record left by a crash in the middle of a write
+	if err := file.Truncate(good); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to truncate write-ahead log: %w", err)
+	}
+	if _, err := file.Seek(good, io.SeekStart); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to seek write-ahead log: %w", err)
+	}
+	w.size, w.baseSize = good, good
+	m.wal = w
+	go m.runWAL(w)
+	return nil
+}
+
+// WALErr returns the first error hit while appending to the write-ahead log, if any.
+// example usage: if err := m.WALErr(); err != nil { log.Println(err) }
+func (m *SafeMapOf[K, V]) WALErr() error {
+	if m.wal == nil {
+		return nil
+	}
+	m.wal.mu.Lock()
+	defer m.wal.mu.Unlock()
+	return m.wal.err
+}
+
+// CompactWAL rewrites the log so it only holds the live entries.
+// example usage: err := m.CompactWAL()
+func (m *SafeMapOf[K, V]) CompactWAL() error {
+	if m.wal == nil {
+		return fmt.Errorf("no write-ahead log open")
+	}
+	return m.compactWAL(m.wal)
+}
+
+// walFrame encodes the record of a write before it is applied, so a write the log
+// cannot hold is refused instead of only living in memory. It is nil without a log.
+func (m *SafeMapOf[K, V]) walFrame(op byte, key K, e *entry[V]) ([]byte, error) {
+	if m.wal == nil {
+		return nil, nil
+	}
+	frame, err := m.wal.encode(op, key, e)
+	if err != nil {
+		m.wal.mu.Lock()
+		m.wal.fail(err)
+		m.wal.mu.Unlock()
+	}
+	return frame, err
+}
+
+// logFrame appends a record written to s, the shard lock must be held.
+// Inside a Batch the record is collected and written with the rest of the batch.
+func (m *SafeMapOf[K, V]) logFrame(s *shard[K, V], frame []byte) {
+	if frame == nil {
+		return
+	}
+	if s.walBatch != nil {
+		*s.walBatch = append(*s.walBatch, frame)
+		return
+	}
+	m.wal.append(frame)
+}
+
+// logSet and logDelete append to the log, they run under the shard lock of key.
+func (m *SafeMapOf[K, V]) logSet(s *shard[K, V], key K, e *entry[V]) {
+	if frame, err := m.walFrame(walOpSet, key, e); err == nil {
+		m.logFrame(s, frame)
+	}
+}
+
+func (m *SafeMapOf[K, V]) logDelete(s *shard[K, V], key K) {
+	if frame, err := m.walFrame(walOpDelete, key, nil); err == nil {
+		m.logFrame(s, frame)
+	}
+}
+
+// appendBatch writes the records of one Batch as a single record, or as several
+// when they do not fit in walMaxRecord. All shards of the batch must still be locked.
+func (w *walLog[K, V]) appendBatch(frames [][]byte) {
+	if len(frames) == 1 {
+		w.append(frames[0])
+		return
+	}
+	for len(frames) > 0 {
+		payload := []byte{walOpBatch}
+		n := 0
+		for n < len(frames) && (n == 0 || len(payload)+len(frames[n]) <= walMaxRecord) {
+			payload = append(payload, frames[n]...)
+			n++
+		}
+		if n == 1 {
+			w.append(frames[0])
+		} else {
+			w.append(walFrameOf(payload))
+		}
+		frames = frames[n:]
+	}
+}
+
+func (w *walLog[K, V]) append(frame []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	if w.compacting {
+		w.pending = append(w.pending, frame)
+	}
+	n, err := w.file.Write(frame)
+	w.size += int64(n)
+	if err != nil {
+		w.fail(fmt.Errorf("failed to append to write-ahead log: %w", err))
+		return
+	}
+	w.dirty = true
+	if w.policy == SyncAlways {
+		w.syncLocked()
+	}
+}
+
+func (w *walLog[K, V]) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *walLog[K, V]) syncLocked() {
+	if !w.dirty {
+		return
+	}
+	if err := w.file.Sync(); err != nil {
+		w.fail(fmt.Errorf("failed to sync write-ahead log: %w", err))
+		return
+	}
+	w.dirty = false
+}
+
+func (m *SafeMapOf[K, V]) runWAL(w *walLog[K, V]) {
+	defer close(w.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.policy == SyncEverySecond {
+				w.syncLocked()
+			}
+			grow := w.size > walCompactMinSize && w.size > 2*w.baseSize
+			w.mu.Unlock()
+			if grow {
+				if err := m.compactWAL(w); err != nil {
+					w.mu.Lock()
+					w.fail(err)
+					w.mu.Unlock()
+				}
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *walLog[K, V]) close() error {
+	close(w.stop)
+	<-w.done
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.syncLocked()
+	w.closed = true
+	if err := w.file.Close(); err != nil {
+		w.fail(fmt.Errorf("failed to close write-ahead log: %w", err))
+	}
+	return w.err
+}
+
+// compactWAL writes the live entries to a new file and swaps it in.
+// Appends that race with the copy are buffered and replayed on top, every record
+// carries the full state of its key so applying one twice is harmless.
+func (m *SafeMapOf[K, V]) compactWAL(w *walLog[K, V]) error {
+	w.mu.Lock()
+	if w.compacting || w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.compacting = true
+	w.pending = nil
+	w.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".compact*")
+	if err != nil {
+		return w.abortCompact(nil, fmt.Errorf("failed to create compacted log: %w", err))
+	}
+	// CreateTemp makes the file 0600, keep the mode of the log it replaces
+	if info, err := os.Stat(w.path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			return w.abortCompact(tmp, fmt.Errorf("failed to set mode of compacted log: %w", err))
+		}
+	}
+	bw := bufio.NewWriter(tmp)
+	var written int64
+	now := m.now()
+	for _, s := range m.shards {
+		s.mu.Lock()
+		var frames [][]byte
+		for key, e := range s.items {
+			if e.expired(now) {
+				continue
+			}
+			frame, err := w.encode(walOpSet, key, e)
+			if err != nil {
+				s.mu.Unlock()
+				return w.abortCompact(tmp, err)
+			}
+			frames = append(frames, frame)
+		}
+		s.mu.Unlock()
+		for _, frame := range frames {
+			n, err := bw.Write(frame)
+			written += int64(n)
+			if err != nil {
+				return w.abortCompact(tmp, fmt.Errorf("failed to write compacted log: %w", err))
+			}
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		w.compacting, w.pending = false, nil
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil
+	}
+	for _, frame := range w.pending {
+		n, err := bw.Write(frame)
+		written += int64(n)
+		if err != nil {
+			return w.abortCompactLocked(tmp, fmt.Errorf("failed to write compacted log: %w", err))
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return w.abortCompactLocked(tmp, fmt.Errorf("failed to write compacted log: %w", err))
+	}
+	if err := tmp.Sync(); err != nil {
+		return w.abortCompactLocked(tmp, fmt.Errorf("failed to sync compacted log: %w", err))
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		return w.abortCompactLocked(tmp, fmt.Errorf("failed to replace write-ahead log: %w", err))
+	}
+	if dir, err := os.Open(filepath.Dir(w.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	w.file.Close()
+	w.file = tmp
+	w.size, w.baseSize = written, written
+	w.dirty = false
+	w.compacting, w.pending = false, nil
+	return nil
+}
+
+func (w *walLog[K, V]) abortCompact(tmp *os.File, err error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.abortCompactLocked(tmp, err)
+}
+
+func (w *walLog[K, V]) abortCompactLocked(tmp *os.File, err error) error {
+	w.compacting, w.pending = false, nil
+	if tmp != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// A frame is [payload length uint32][crc32 of payload][payload], all big endian.
+// The payload is op, expire unix nanos, sliding, counter, key, value and tags.
+// A batch payload is walOpBatch followed by the complete frames of its writes.
+func (w *walLog[K, V]) encode(op byte, key K, e *entry[V]) ([]byte, error) {
+	kb, err := encodeWALKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key %v: %w", key, err)
+	}
+	var vb []byte
+	var expire, sliding int64
+	var counter uint32
+	var tags []string
+	if e != nil {
+		if vb, err = w.codec.Marshal(e.value); err != nil {
+			return nil, fmt.Errorf("failed to encode value for key %v: %w", key, err)
+		}
+		if !e.expire.IsZero() {
+			expire = e.expire.UnixNano()
+		}
+		sliding = int64(e.sliding)
+		counter = e.getcounter.Load()
+		tags = e.tags
+	}
+	if len(tags) > math.MaxUint16 {
+		return nil, fmt.Errorf("failed to encode key %v: %d tags, at most %d fit in the write-ahead log", key, len(tags), math.MaxUint16)
+	}
+	for _, t := range tags {
+		if len(t) > math.MaxUint16 {
+			return nil, fmt.Errorf("failed to encode key %v: tag of %d bytes, at most %d fit in the write-ahead log", key, len(t), math.MaxUint16)
+		}
+	}
+
+	payload := make([]byte, 0, 1+8+8+4+4+len(kb)+4+len(vb)+2)
+	payload = append(payload, op)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(expire))
+	payload = binary.BigEndian.AppendUint64(payload, uint64(sliding))
+	payload = binary.BigEndian.AppendUint32(payload, counter)
+	payload = binary.BigEndian.AppendUint32(payload, uint32(len(kb)))
+	payload = append(payload, kb...)
+	payload = binary.BigEndian.AppendUint32(payload, uint32(len(vb)))
+	payload = append(payload, vb...)
+	payload = binary.BigEndian.AppendUint16(payload, uint16(len(tags)))
+	for _, t := range tags {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(len(t)))
+		payload = append(payload, t...)
+	}
+	if len(payload) > walMaxRecord {
+		return nil, fmt.Errorf("failed to encode key %v: record of %d bytes is over the %d byte write-ahead log limit", key, len(payload), walMaxRecord)
+	}
+	return walFrameOf(payload), nil
+}
+
+func walFrameOf(payload []byte) []byte {
+	frame := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	return append(frame, payload...)
+}
+
+var errWALCorrupt = errors.New("corrupt write-ahead log record")
+
+// replayWAL applies every record in the log to the map and returns the offset
+// after the last intact one. A short or bad last record is a torn write and is
+// left for the caller to truncate, damage before the end returns errWALCorrupt.
+func (m *SafeMapOf[K, V]) replayWAL(w *walLog[K, V]) (int64, error) {
+	r := bufio.NewReader(w.file)
+	var good int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return good, nil
+		}
+		size := binary.BigEndian.Uint32(header[0:4])
+		// a torn write leaves a short record, not a huge length, so this is damage
+		if size > walMaxRecord {
+			return 0, fmt.Errorf("failed to replay write-ahead log: %w: %d byte record at offset %d", errWALCorrupt, size, good)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return good, nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			// only the last record can be torn, a bad one with records after it is damage
+			// and truncating there would drop every record that follows
+			if _, err := r.Peek(1); err == io.EOF {
+				return good, nil
+			}
+			return 0, fmt.Errorf("failed to replay write-ahead log: %w: checksum mismatch at offset %d", errWALCorrupt, good)
+		}
+		records, err := m.decodeWALRecords(w, payload)
+		if err != nil {
+			return 0, fmt.Errorf("failed to replay write-ahead log at offset %d: %w", good, err)
+		}
+		// a batch is decoded in full before any of it is applied
+		for _, rec := range records {
+			m.applyWALRecord(rec)
+		}
+		good += int64(8 + size)
+	}
+}
+
+type walRecord[K comparable, V any] struct {
+	op  byte
+	key K
+	e   *entry[V]
+}
+
+// decodeWALRecords decodes one record, or every write of a batch record.
+func (m *SafeMapOf[K, V]) decodeWALRecords(w *walLog[K, V], p []byte) ([]walRecord[K, V], error) {
+	if len(p) == 0 || p[0] != walOpBatch {
+		rec, err := m.decodeWALRecord(w, p)
+		if err != nil {
+			return nil, err
+		}
+		return []walRecord[K, V]{rec}, nil
+	}
+	var records []walRecord[K, V]
+	for p = p[1:]; len(p) > 0; {
+		if len(p) < 8 {
+			return nil, errWALCorrupt
+		}
+		size := int(binary.BigEndian.Uint32(p[0:4]))
+		if len(p) < 8+size || crc32.ChecksumIEEE(p[8:8+size]) != binary.BigEndian.Uint32(p[4:8]) {
+			return nil, errWALCorrupt
+		}
+		rec, err := m.decodeWALRecord(w, p[8:8+size])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+		p = p[8+size:]
+	}
+	return records, nil
+}
+
+func (m *SafeMapOf[K, V]) decodeWALRecord(w *walLog[K, V], p []byte) (walRecord[K, V], error) {
+	var rec walRecord[K, V]
+	if len(p) < 25 {
+		return rec, errWALCorrupt
+	}
+	rec.op = p[0]
+	expire := int64(binary.BigEndian.Uint64(p[1:9]))
+	sliding := time.Duration(binary.BigEndian.Uint64(p[9:17]))
+	counter := binary.BigEndian.Uint32(p[17:21])
+	p = p[21:]
+
+	kb, p, ok := walChunk32(p)
+	if !ok {
+		return rec, errWALCorrupt
+	}
+	key, err := decodeWALKey[K](kb)
+	if err != nil {
+		return rec, fmt.Errorf("failed to decode key in write-ahead log: %w", err)
+	}
+	rec.key = key
+	if rec.op == walOpDelete {
+		return rec, nil
+	}
+	if rec.op != walOpSet {
+		return rec, errWALCorrupt
+	}
+
+	vb, p, ok := walChunk32(p)
+	if !ok || len(p) < 2 {
+		return rec, errWALCorrupt
+	}
+	n := int(binary.BigEndian.Uint16(p))
+	p = p[2:]
+	var tags []string
+	for i := 0; i < n; i++ {
+		if len(p) < 2 {
+			return rec, errWALCorrupt
+		}
+		l := int(binary.BigEndian.Uint16(p))
+		if len(p) < 2+l {
+			return rec, errWALCorrupt
+		}
+		tags = append(tags, string(p[2:2+l]))
+		p = p[2+l:]
+	}
+	value, err := w.codec.Unmarshal(vb)
+	if err != nil {
+		return rec, fmt.Errorf("failed to decode value for key %v in write-ahead log: %w", key, err)
+	}
+
+	rec.e = &entry[V]{value: value, sliding: sliding, tags: tags}
+	rec.e.getcounter.Store(counter)
+	switch {
+	case sliding > 0:
+		rec.e.expire = m.now().Add(sliding)
+	case expire != 0:
+		rec.e.expire = time.Unix(0, expire)
+	}
+	return rec, nil
+}
+
+func (m *SafeMapOf[K, V]) applyWALRecord(rec walRecord[K, V]) {
+	s := m.shards[m.getShardIndex(rec.key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec.op == walOpDelete || rec.e.expired(m.now()) {
+		m.removeLocked(s, rec.key)
+		return
+	}
+	m.insertLocked(s, rec.key, rec.e)
+}
+
+func walChunk32(p []byte) ([]byte, []byte, bool) {
+	if len(p) < 4 {
+		return nil, nil, false
+	}
+	l := int(binary.BigEndian.Uint32(p))
+	if len(p) < 4+l {
+		return nil, nil, false
+	}
+	return p[4 : 4+l], p[4+l:], true
+}
+
+func encodeWALKey[K comparable](key K) ([]byte, error) {
+	if s, ok := any(key).(string); ok {
+		return []byte(s), nil
+	}
+	return GobCodec[K]{}.Marshal(key)
+}
+
+func decodeWALKey[K comparable](b []byte) (K, error) {
+	var zero K
+	if _, ok := any(zero).(string); ok {
+		return any(string(b)).(K), nil
+	}
+	return GobCodec[K]{}.Unmarshal(b)
+}
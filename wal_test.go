@@ -0,0 +1,196 @@
+package ez
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestWAL(t *testing.T, path string) *SafeMap {
+	t.Helper()
+	m, err := OpenSafeMap(path, 4, SyncNever, WithQuiet(), WithJanitorInterval(0))
+	if err != nil {
+		t.Fatalf("OpenSafeMap: %v", err)
+	}
+	return m
+}
+
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	m := openTestWAL(t, path)
+	m.Insert("a", 0, "one", "red")
+	m.InsertWithTTL("b", time.Hour, 0, 2)
+	m.Insert("c", 0, 3)
+	m.Delete("c")
+	m.Insert("a", 0, "uno", "blue")
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	m = openTestWAL(t, path)
+	defer m.Close()
+	if v, ok := m.Get("a"); !ok || v != "uno" {
+		t.Fatalf("Get(a) = %v, %v, want uno, true", v, ok)
+	}
+	if tags := m.Tags("a"); len(tags) != 1 || tags[0] != "blue" {
+		t.Fatalf("Tags(a) = %v, want [blue]", tags)
+	}
+	if v, ok := m.Get("b"); !ok || v != 2 {
+		t.Fatalf("Get(b) = %v, %v, want 2, true", v, ok)
+	}
+	if _, ok := m.Get("c"); ok {
+		t.Fatal("deleted key c came back after replay")
+	}
+}
+
+func TestWALCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	m := openTestWAL(t, path)
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		m.Insert("k", 0, i)
+	}
+	m.Insert("other", 0, "x")
+	before, _ := os.Stat(path)
+	if err := m.CompactWAL(); err != nil {
+		t.Fatalf("CompactWAL: %v", err)
+	}
+	m.Insert("after", 0, true)
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() >= before.Size() {
+		t.Fatalf("log is %d bytes after compaction, was %d", after.Size(), before.Size())
+	}
+	if mode := after.Mode().Perm(); mode != 0640 {
+		t.Fatalf("compacted log mode = %v, want 0640", mode)
+	}
+
+	m = openTestWAL(t, path)
+	defer m.Close()
+	if v, ok := m.Get("k"); !ok || v != 499 {
+		t.Fatalf("Get(k) = %v, %v, want 499, true", v, ok)
+	}
+	if m.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", m.Len())
+	}
+}
+
+func TestWALBatchIsAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	m := openTestWAL(t, path)
+	m.Insert("before", 0, 1)
+	m.Close()
+	base, _ := os.Stat(path)
+
+	m = openTestWAL(t, path)
+	m.MSet(map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4}, 0)
+	m.Close()
+
+	// a crash in the middle of the batch record must lose all of it
+	full, _ := os.Stat(path)
+	if err := os.Truncate(path, base.Size()+(full.Size()-base.Size())/2); err != nil {
+		t.Fatal(err)
+	}
+	m = openTestWAL(t, path)
+	defer m.Close()
+	if m.Len() != 1 {
+		t.Fatalf("Len() = %d after torn batch, want 1", m.Len())
+	}
+}
+
+func TestWALRejectsHugeRecordHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, 1<<31)
+	if err := os.WriteFile(path, header, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := OpenSafeMap(path, 4, SyncNever, WithQuiet()); err == nil {
+		m.Close()
+		t.Fatal("OpenSafeMap accepted a 2GB record header")
+	}
+}
+
+func TestWALRefusesUnloggableWrites(t *testing.T) {
+	type unregistered struct{ N int }
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	m := openTestWAL(t, path)
+	defer m.Close()
+
+	m.Insert("tag", 0, "v", strings.Repeat("x", 1<<16))
+	if _, ok := m.Get("tag"); ok {
+		t.Fatal("write with a 64KB tag was stored")
+	}
+	m.Insert("gob", 0, "old")
+	m.Insert("gob", 0, unregistered{1})
+	if v, ok := m.Get("gob"); !ok || v != "old" {
+		t.Fatalf("Get(gob) = %v, %v, want the old value kept", v, ok)
+	}
+	if m.WALErr() == nil {
+		t.Fatal("WALErr() = nil after refused writes")
+	}
+}
+
+func TestWALDamage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	m := openTestWAL(t, path)
+	m.Insert("a", 0, "one")
+	m.Close()
+	first, _ := os.Stat(path)
+	m = openTestWAL(t, path)
+	m.Insert("b", 0, "two")
+	m.Close()
+	second, _ := os.Stat(path)
+	m = openTestWAL(t, path)
+	m.Insert("c", 0, "three")
+	m.Close()
+	full, _ := os.Stat(path)
+
+	flip := func(off int64) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[off] ^= 0xff
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a bad last record is a torn write and is dropped
+	flip(full.Size() - 1)
+	m = openTestWAL(t, path)
+	if m.Len() != 2 {
+		t.Fatalf("Len() = %d after torn last record, want 2", m.Len())
+	}
+	m.Close()
+	if fi, _ := os.Stat(path); fi.Size() != second.Size() {
+		t.Fatalf("size = %d after torn last record, want it truncated to %d", fi.Size(), second.Size())
+	}
+
+	// a bad record with records after it must not be truncated away
+	m = openTestWAL(t, path)
+	m.Insert("c", 0, "three")
+	m.Close()
+	full, _ = os.Stat(path)
+	flip(first.Size() + 9)
+	if m, err := OpenSafeMap(path, 4, SyncNever, WithQuiet()); err == nil {
+		m.Close()
+		t.Fatal("OpenSafeMap accepted a damaged record in the middle of the log")
+	}
+	if fi, _ := os.Stat(path); fi.Size() != full.Size() {
+		t.Fatalf("size = %d after refused open, want %d", fi.Size(), full.Size())
+	}
+}